@@ -14,6 +14,13 @@ type Actor interface {
 	Act(c context.Context)
 }
 
+// HandoffActor is an actor that can hand its state to a successor,
+// on another peer, when its server drains. See Server.Drain.
+type HandoffActor interface {
+	Actor
+	Handoff(c context.Context) error
+}
+
 // NewActorStart message with the name of the actor
 // to start, its type will be equal to its name
 // unless its changed:
@@ -26,6 +33,12 @@ type Actor interface {
 //     start := NewActorStart("worker-%d-group-%d", i, j)
 //     start.Type = "worker"
 //
+// Annotations, such as "role=worker" or "shard=3", are stored in
+// the actor's registration and returned by the client's Query
+// methods:
+//
+//     start.Annotations = []string{"role=worker", "shard=3"}
+//
 func NewActorStart(name string, v ...interface{}) *ActorStart {
 	fullName := name
 	if len(v) > 0 {
@@ -41,3 +54,12 @@ func init() {
 	Register(Ack{})
 	Register(ActorStart{})
 }
+
+// NewMessage for decoding, see codec.Constructor.
+func (Ack) NewMessage() interface{} { return &Ack{} }
+
+// NewMessage for decoding, see codec.Constructor.
+func (ActorStart) NewMessage() interface{} { return &ActorStart{} }
+
+// NewMessage for decoding, see codec.Constructor.
+func (EchoMsg) NewMessage() interface{} { return &EchoMsg{} }
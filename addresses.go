@@ -0,0 +1,93 @@
+package grid
+
+import (
+	"context"
+	"time"
+
+	"github.com/lytics/grid/registry"
+)
+
+// watchAddresses of the namespace's mailboxes, keeping the
+// client's address cache in step with the registry until
+// the context is done.
+func (c *Client) watchAddresses(ctx context.Context) {
+	nsPrefix, err := namespacePrefix(Mailboxes, c.cfg.Namespace)
+	if err != nil {
+		c.logf("failed watching mailbox addresses: %v", err)
+		return
+	}
+
+	for {
+		err := c.watchAddressesOnce(ctx, nsPrefix)
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		// While not watching, the cache could go stale
+		// without the client knowing, so drop it and
+		// fall back to looking up addresses on demand.
+		c.mu.Lock()
+		c.addresses = make(map[string]string)
+		c.peers = make(map[string]string)
+		c.mu.Unlock()
+		c.logf("watch of mailbox addresses failed, restarting: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.cfg.Timeout):
+		}
+	}
+}
+
+// watchAddressesOnce fills the address cache with the current
+// mailboxes and applies changes until the watch fails.
+func (c *Client) watchAddressesOnce(ctx context.Context, nsPrefix string) error {
+	regs, changes, err := c.registry.ResumeWatch(ctx, nsPrefix)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	for _, reg := range regs {
+		c.addresses[reg.Key] = reg.Address
+		c.peers[reg.Key] = reg.Registry
+	}
+	c.mu.Unlock()
+
+	for change := range changes {
+		if change.Error != nil {
+			return change.Error
+		}
+		switch change.Type {
+		case registry.Delete:
+			c.evictAddress(change.Key)
+		case registry.Create, registry.Modify:
+			c.updateAddress(change.Key, change.Reg)
+		}
+	}
+	return ErrWatchClosedUnexpectedly
+}
+
+func (c *Client) updateAddress(nsReceiver string, reg *registry.Registration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Test hook.
+	c.cs.Inc(numAddressWatchUpdate)
+
+	c.addresses[nsReceiver] = reg.Address
+	c.peers[nsReceiver] = reg.Registry
+}
+
+func (c *Client) evictAddress(nsReceiver string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Test hook.
+	c.cs.Inc(numAddressWatchEvict)
+
+	delete(c.addresses, nsReceiver)
+	delete(c.peers, nsReceiver)
+}
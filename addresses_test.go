@@ -0,0 +1,53 @@
+package grid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClientWatchAddresses(t *testing.T) {
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	watching, err := NewClient(etcd, ClientCfg{Namespace: server.cfg.Namespace, WatchAddresses: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watching.Close()
+
+	nsName, err := namespaceName(Mailboxes, server.cfg.Namespace, "watched")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := func() bool {
+		watching.mu.Lock()
+		defer watching.mu.Unlock()
+		_, ok := watching.addresses[nsName]
+		return ok
+	}
+	waitFor := func(expected bool) {
+		t0 := time.Now()
+		for cached() != expected {
+			if time.Since(t0) > 10*time.Second {
+				t.Fatalf("expected mailbox cached: %v", expected)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	// The address is cached without any request.
+	mailbox, err := NewMailbox(server, "watched", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(true)
+
+	// And evicted as soon as the mailbox is gone.
+	err = mailbox.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(false)
+}
@@ -3,6 +3,9 @@ package grid
 import (
 	"runtime"
 	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
 )
 
 // Logger hides the logging function Printf behind a simple
@@ -16,6 +19,11 @@ type Logger interface {
 type ClientCfg struct {
 	// Namespace of grid.
 	Namespace string
+	// RootPrefix in etcd under which every key of the grid is
+	// stored, for example "/acme/grid", see KeyLayoutVersion. The
+	// default of an empty prefix keeps the flat layout. Servers
+	// and clients of a namespace must use the same root prefix.
+	RootPrefix string
 	// Timeout for communication with etcd, and internal gossip.
 	Timeout time.Duration
 	// PeersRefreshInterval for polling list of peers in etcd.
@@ -25,6 +33,66 @@ type ClientCfg struct {
 	// More connections allow for more messages per second,
 	// but increases the number of file-handles used.
 	ConnectionsPerPeer int
+	// CompressionThreshold in bytes, requests whose encoded message
+	// is at least this large are gzip compressed, if the receiver's
+	// peer advertised gzip in its last response. Requests to a peer
+	// are not compressed until it has responded once. The default of
+	// zero disables compression of requests.
+	CompressionThreshold int
+	// CheckSchemas of messages against the message types published
+	// by the receiver's peer before sending, and fail requests with
+	// ErrUndecodableMessage if the peer cannot decode the message.
+	// Differing schema fingerprints are only logged, since many
+	// changes, such as new protobuf fields, are compatible. The
+	// client watches the namespace's peers to keep their schemas
+	// current.
+	CheckSchemas bool
+	// Locality of the client as peer annotations, most significant
+	// first, for example "zone=us-east-1a", "rack=12". Broadcasts to
+	// the Fastest of a group first try the receivers on peers sharing
+	// the most of the locality, and fall back to the others only if
+	// none of those respond. See also NearestPeers. The client
+	// watches the namespace's peers and mailboxes, as with
+	// WatchAddresses, so that ranks follow peers whose annotations
+	// change and receivers which move.
+	Locality []string
+	// WatchBuffer of each of the client's watches, in events.
+	// Watches of the same entities share one etcd watch, and a
+	// watch whose buffer is full is dealt with according to the
+	// SlowWatcherPolicy. The default is 1024 events.
+	WatchBuffer int
+	// SlowWatcherPolicy for watches whose buffer is full, the
+	// default disconnects the slow watcher so that it does not
+	// hold up the other watches sharing its etcd watch.
+	SlowWatcherPolicy SlowWatcherPolicy
+	// WatchAddresses of mailboxes in the registry, so that the
+	// client's address cache is updated as soon as a mailbox
+	// moves or is removed, instead of after a failed request.
+	// It costs one etcd watch per client.
+	WatchAddresses bool
+	// HealthCheckInterval between checks of the connections to
+	// peers. Connections which failed, or do not answer a health
+	// ping, are redialed, and connections to peers which have
+	// left the namespace are closed. The default of zero disables
+	// the checks, and broken connections are only found when a
+	// request fails.
+	HealthCheckInterval time.Duration
+	// MaxMessageSize in bytes of requests sent and responses
+	// received. The default of zero uses gRPC's default, which
+	// limits received messages to 4MB.
+	MaxMessageSize int
+	// Keepalive of connections to peers, the zero value uses
+	// gRPC's defaults.
+	Keepalive keepalive.ClientParameters
+	// InitialWindowSize and InitialConnWindowSize of connections
+	// to peers, in bytes, the default of zero uses gRPC's defaults.
+	InitialWindowSize     int32
+	InitialConnWindowSize int32
+	// DialOptions applied when dialing peers, after the options
+	// the client sets itself, which are an insecure transport, a
+	// maximum reconnect backoff of 20 seconds, and those from the
+	// fields above.
+	DialOptions []grpc.DialOption
 	// Logger optionally used for logging, default is to not log.
 	Logger Logger
 }
@@ -40,6 +108,9 @@ func setClientCfgDefaults(cfg *ClientCfg) {
 	if cfg.ConnectionsPerPeer == 0 {
 		cfg.ConnectionsPerPeer = maxInt(1, runtime.NumCPU()/2)
 	}
+	if cfg.WatchBuffer == 0 {
+		cfg.WatchBuffer = 1024
+	}
 }
 
 // ServerCfg where the only required argument is Namespace,
@@ -47,16 +118,59 @@ func setClientCfgDefaults(cfg *ClientCfg) {
 type ServerCfg struct {
 	// Namespace of grid.
 	Namespace string
+	// RootPrefix in etcd under which every key of the grid is
+	// stored, for example "/acme/grid", see KeyLayoutVersion. The
+	// default of an empty prefix keeps the flat layout. Servers
+	// and clients of a namespace must use the same root prefix.
+	RootPrefix string
 	// DisalowLeadership to prevent leader from running on a node.
 	DisalowLeadership bool
 	// Timeout for communication with etcd, and internal gossip.
 	Timeout time.Duration
 	// LeaseDuration for data in etcd.
 	LeaseDuration time.Duration
+	// AdvertiseAddress, as host:port or unix://path, under which
+	// clients reach the server, when it differs from the address
+	// of the listener, for example behind NAT or in a container.
+	// IPv6 hosts are written in brackets, as in "[::1]:7777".
+	AdvertiseAddress string
+	// RecoverLease of the registry when its keep alive fails,
+	// instead of treating the failure as fatal. A new lease is
+	// granted, and the peer, its actors and its mailboxes are
+	// registered again. Actors and mailboxes whose names were
+	// claimed by another peer in the meantime are stopped and
+	// closed. Recovery is retried for up to the LeaseDuration.
+	RecoverLease bool
+	// OnLeaseRecovery optionally called after each recovery of
+	// the lease, with what was lost.
+	OnLeaseRecovery func(*LeaseRecovery)
 	// Logger optionally used for logging, default is to not log.
 	Logger Logger
 	// Annotations optionally used annotating a grid server with metadata
 	Annotations []string
+	// CompressionThreshold in bytes, responses whose encoded message
+	// is at least this large are gzip compressed, if the requester
+	// accepts it. The default of zero disables compression.
+	CompressionThreshold int
+	// EnableReflection of the gRPC services served by the server,
+	// for generic tooling such as grpcurl.
+	EnableReflection bool
+	// MaxMessageSize in bytes of requests received and responses
+	// sent. The default of zero uses gRPC's default, which limits
+	// received messages to 4MB.
+	MaxMessageSize int
+	// Keepalive of connections from clients, and its enforcement
+	// policy, the zero values use gRPC's defaults.
+	Keepalive            keepalive.ServerParameters
+	KeepaliveEnforcement keepalive.EnforcementPolicy
+	// InitialWindowSize and InitialConnWindowSize of connections
+	// from clients, in bytes, the default of zero uses gRPC's
+	// defaults.
+	InitialWindowSize     int32
+	InitialConnWindowSize int32
+	// ServerOptions applied when creating the gRPC server, after
+	// the options from the fields above.
+	ServerOptions []grpc.ServerOption
 }
 
 // setServerCfgDefaults for those fields that have their zero value.
@@ -69,6 +183,61 @@ func setServerCfgDefaults(cfg *ServerCfg) {
 	}
 }
 
+// SingletonCfg of a cluster singleton, an actor of which one, and
+// only one, runs in the namespace, restarted on another peer when
+// it dies or its peer leaves. Every field is optional, fields with
+// their zero value will receive defaults.
+type SingletonCfg struct {
+	// Name of the singleton actor, default is the actor type.
+	Name string
+	// Data and Annotations of the ActorStart used to start
+	// the singleton.
+	Data        []byte
+	Annotations []string
+	// FailoverDelay a peer waits, once the singleton is lost,
+	// before trying to start it. Peers missing some of the
+	// Prefer annotations wait an extra FailoverDelay for each
+	// one missing, so preferred peers take over first.
+	FailoverDelay time.Duration
+	// CheckInterval at which a peer checks that the singleton
+	// is running, in case a loss was not observed.
+	CheckInterval time.Duration
+	// Backoff between attempts to start the singleton, doubled
+	// after each failed attempt up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Attempts to start the singleton before the failure is
+	// reported as a fatal error of the server.
+	Attempts int
+	// Prefer peers annotated with these annotations.
+	Prefer []string
+	// Require peers to be annotated with these annotations,
+	// other peers never run the singleton.
+	Require []string
+}
+
+// setSingletonCfgDefaults for those fields that have their zero value.
+func setSingletonCfgDefaults(actorType string, cfg *SingletonCfg) {
+	if cfg.Name == "" {
+		cfg.Name = actorType
+	}
+	if cfg.FailoverDelay == 0 {
+		cfg.FailoverDelay = 1 * time.Second
+	}
+	if cfg.CheckInterval == 0 {
+		cfg.CheckInterval = 30 * time.Second
+	}
+	if cfg.Backoff == 0 {
+		cfg.Backoff = 1 * time.Second
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = cfg.Backoff
+	}
+	if cfg.Attempts == 0 {
+		cfg.Attempts = 6
+	}
+}
+
 func maxInt(a, b int) int {
 	if a < b {
 		return a
@@ -21,6 +21,12 @@ func TestSetClientCfgDefaults(t *testing.T) {
 	if cfg.PeersRefreshInterval != 2*time.Second {
 		t.Fatalf("initial PeersRefreshInterval should be 2s")
 	}
+	if cfg.WatchBuffer != 1024 {
+		t.Fatalf("initial WatchBuffer should be 1024")
+	}
+	if cfg.SlowWatcherPolicy != DisconnectSlowWatcher {
+		t.Fatalf("initial SlowWatcherPolicy should be DisconnectSlowWatcher")
+	}
 }
 
 func TestSetServerCfgDefaults(t *testing.T) {
@@ -42,3 +48,25 @@ func TestSetServerCfgDefaults(t *testing.T) {
 		t.Fatalf("initial LeaseDuration should be 60s")
 	}
 }
+
+func TestSetSingletonCfgDefaults(t *testing.T) {
+	cfg := SingletonCfg{Backoff: 2 * time.Second}
+
+	setSingletonCfgDefaults("scheduler", &cfg)
+
+	if cfg.Name != "scheduler" {
+		t.Fatalf("initial Name should be the actor type")
+	}
+	if cfg.FailoverDelay != 1*time.Second {
+		t.Fatalf("initial FailoverDelay should be 1s")
+	}
+	if cfg.CheckInterval != 30*time.Second {
+		t.Fatalf("initial CheckInterval should be 30s")
+	}
+	if cfg.MaxBackoff != 2*time.Second {
+		t.Fatalf("initial MaxBackoff should be the Backoff")
+	}
+	if cfg.Attempts != 6 {
+		t.Fatalf("initial Attempts should be 6")
+	}
+}
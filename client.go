@@ -25,10 +25,36 @@ import (
 //     Register(MyMsg{})    // Correct
 //     Register(&MyMsg{})   // Incorrect
 //
+// Types implementing codec.Constructor are decoded
+// without reflection.
+//
 func Register(v interface{}) error {
 	return codec.Register(v)
 }
 
+// RegisterWithCodec a message so it may be sent and received,
+// encoded with the given codec instead of protobuf. The codec
+// package contains the built-in codecs JSON and Gob:
+//
+//     RegisterWithCodec(MyStruct{}, codec.JSON)
+//
+// Both sender and receiver must register the type.
+func RegisterWithCodec(v interface{}, c codec.Codec) error {
+	return codec.RegisterWithCodec(v, c)
+}
+
+// RegisterName of a message so it may be sent and received under
+// a name which is stable, independent of the Go package the type
+// lives in. An empty name means the protobuf full message name.
+// Aliases, such as the name a previous build used, are decoded
+// into the same type:
+//
+//     RegisterName("", msg.Person{}, "github.com/acme/app/msg/Person")
+//
+func RegisterName(name string, v interface{}, aliases ...string) error {
+	return codec.RegisterName(name, v, aliases...)
+}
+
 //clientAndConnPool is a pool of clientAndConn
 type clientAndConnPool struct {
 	// The 'id' is used in a kind of CAS when
@@ -99,6 +125,19 @@ type Client struct {
 	registry        *registry.Registry
 	addresses       map[string]string
 	clientsAndConns map[string]*clientAndConnPool
+	// Schemas published by peers, by peer name, only
+	// used if the config enables CheckSchemas.
+	schemas map[string]*peerSchemas
+	// Compressions accepted by peers, by peer address,
+	// as advertised in their last response.
+	accepted map[string][]Delivery_Compression
+	// Peers of receivers, and locality ranks of peers by
+	// peer name, only used if the config sets a Locality.
+	peers map[string]string
+	ranks map[string]int
+	// Cancels the address watch and connection monitor,
+	// if the config enables them.
+	cancel func()
 	// Test hook.
 	cs *clientStats
 }
@@ -107,27 +146,55 @@ type Client struct {
 func NewClient(etcd *etcdv3.Client, cfg ClientCfg) (*Client, error) {
 	setClientCfgDefaults(&cfg)
 
-	r, err := registry.New(etcd)
+	prefix, err := keyspace(cfg.RootPrefix)
+	if err != nil {
+		return nil, err
+	}
+	r, err := registry.NewWithPrefix(etcd, prefix)
 	if err != nil {
 		return nil, err
 	}
 	r.Timeout = cfg.Timeout
+	r.WatchBuffer = cfg.WatchBuffer
+	r.SlowSubscriberPolicy = registry.SlowSubscriberPolicy(cfg.SlowWatcherPolicy)
 
 	// Set registry logger.
 	if cfg.Logger != nil {
 		r.Logger = cfg.Logger
 	}
 
-	return &Client{
+	c := &Client{
 		cfg:             cfg,
 		registry:        r,
 		addresses:       make(map[string]string),
 		clientsAndConns: make(map[string]*clientAndConnPool),
-	}, nil
+		schemas:         make(map[string]*peerSchemas),
+		accepted:        make(map[string][]Delivery_Compression),
+		peers:           make(map[string]string),
+		ranks:           make(map[string]int),
+		cancel:          func() {},
+	}
+	hasLocality := len(cfg.Locality) > 0
+	if cfg.WatchAddresses || cfg.CheckSchemas || hasLocality || cfg.HealthCheckInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		c.cancel = cancel
+		if cfg.WatchAddresses || hasLocality {
+			go c.watchAddresses(ctx)
+		}
+		if cfg.CheckSchemas || hasLocality {
+			go c.watchPeers(ctx)
+		}
+		if cfg.HealthCheckInterval > 0 {
+			go c.monitorConnections(ctx)
+		}
+	}
+	return c, nil
 }
 
 // Close all outbound connections of this client immediately.
 func (c *Client) Close() error {
+	c.cancel()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	var err error
@@ -148,7 +215,8 @@ func (c *Client) Request(timeout time.Duration, receiver string, msg interface{}
 }
 
 // RequestC (request) a response for the given message. The context can be
-// used to control cancelation or timeouts.
+// used to control cancelation or timeouts, and to carry a fencing token to
+// the receiver, see WithFencingToken.
 func (c *Client) RequestC(ctx context.Context, receiver string, msg interface{}) (interface{}, error) {
 	// Namespaced receiver name.
 	nsReceiver, err := namespaceName(Mailboxes, c.cfg.Namespace, receiver)
@@ -156,16 +224,35 @@ func (c *Client) RequestC(ctx context.Context, receiver string, msg interface{})
 		return nil, err
 	}
 
-	typeName, data, err := codec.Marshal(msg)
+	// The marshalled message is only referenced by the
+	// request, which gRPC is done with once Process has
+	// returned, so the buffer can be reused afterwards.
+	buf, err := codec.MarshalBuffer(msg)
+	if err != nil {
+		return nil, err
+	}
+	defer buf.Release()
+	typeName := buf.TypeName
+
+	// Only compress with what the receiver's peer has
+	// advertised it accepts, so the first request to a
+	// peer is never compressed.
+	data, compression, err := compress(buf.Data, c.cfg.CompressionThreshold, c.acceptedCompression(nsReceiver))
 	if err != nil {
 		return nil, err
 	}
 
 	req := &Delivery{
-		Ver:      Delivery_V1,
-		Data:     data,
-		TypeName: typeName,
-		Receiver: nsReceiver,
+		Ver:               Delivery_V1,
+		Data:              data,
+		TypeName:          typeName,
+		Receiver:          nsReceiver,
+		CodecName:         buf.CodecName,
+		Compression:       compression,
+		AcceptCompression: supportedCompression,
+	}
+	if token, ok := FencingToken(ctx); ok {
+		req.FencingToken = token
 	}
 
 	var res *Delivery
@@ -185,7 +272,16 @@ func (c *Client) RequestC(ctx context.Context, receiver string, msg interface{})
 		if err != nil {
 			return false
 		}
+		if c.cfg.CheckSchemas {
+			err = c.checkSchema(nsReceiver, typeName)
+			if err != nil {
+				return false
+			}
+		}
 		res, err = client.Process(ctx, req)
+		if err == nil {
+			c.setAcceptedCompression(nsReceiver, res.AcceptCompression)
+		}
 		if err != nil && strings.Contains(err.Error(), "Error while dialing") {
 			// Test hook.
 			c.cs.Inc(numErrWhileDialing)
@@ -258,6 +354,21 @@ func (c *Client) RequestC(ctx context.Context, receiver string, msg interface{})
 				return true
 			}
 		}
+		if err != nil && strings.Contains(err.Error(), ErrServerDraining.Error()) {
+			// Test hook.
+			c.cs.Inc(numErrServerDraining)
+			// Receiver's peer is draining, so the receiver
+			// did NOT get the message, and is possibly
+			// moving to another peer. Get rid of the old
+			// address and send again.
+			c.deleteAddress(nsReceiver)
+			select {
+			case <-ctx.Done():
+				return false
+			default:
+				return true
+			}
+		}
 		if err != nil && strings.Contains(err.Error(), ErrReceiverBusy.Error()) {
 			// Test hook.
 			c.cs.Inc(numErrReceiverBusy)
@@ -278,7 +389,12 @@ func (c *Client) RequestC(ctx context.Context, receiver string, msg interface{})
 		return nil, err
 	}
 
-	reply, err := codec.Unmarshal(res.Data, res.TypeName)
+	data, err = decompress(res.Data, res.Compression, c.cfg.MaxMessageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := codec.UnmarshalCodec(data, res.TypeName, res.CodecName)
 	if err != nil {
 		return nil, err
 	}
@@ -307,25 +423,21 @@ func (c *Client) getWireClient(ctx context.Context, nsReceiver string) (WireClie
 		}
 		address = reg.Address
 		c.addresses[nsReceiver] = address
+		c.peers[nsReceiver] = reg.Registry
+	}
+
+	if peer := c.peers[nsReceiver]; c.cfg.CheckSchemas && !c.hasSchemas(peer) {
+		c.fetchSchemas(ctx, peer)
 	}
 
 	ccpool, ok := c.clientsAndConns[address]
 	if !ok {
 		ccpool = &clientAndConnPool{id: rand.Int63(), clientConns: make([]*clientAndConn, c.cfg.ConnectionsPerPeer)}
 		for i := 0; i < c.cfg.ConnectionsPerPeer; i++ {
-			// Test hook.
-			c.cs.Inc(numGRPCDial)
-
-			// Dial the destination.
-			conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBackoffMaxDelay(20*time.Second))
+			cc, err := c.dial(address)
 			if err != nil {
 				return nil, noID, err
 			}
-			client := NewWireClient(conn)
-			cc := &clientAndConn{
-				conn:   conn,
-				client: client,
-			}
 			ccpool.clientConns[i] = cc
 		}
 		c.clientsAndConns[address] = ccpool
@@ -337,6 +449,82 @@ func (c *Client) getWireClient(ctx context.Context, nsReceiver string) (WireClie
 	return cc.client, ccpool.id, nil
 }
 
+// dial the address, returning a new client and connection.
+func (c *Client) dial(address string) (*clientAndConn, error) {
+	// Test hook.
+	c.cs.Inc(numGRPCDial)
+
+	// Dial the destination.
+	conn, err := grpc.Dial(address, dialOptions(c.cfg)...)
+	if err != nil {
+		return nil, err
+	}
+	return &clientAndConn{
+		conn:   conn,
+		client: NewWireClient(conn),
+	}, nil
+}
+
+// fetchSchemas published by the peer, and cache them by the
+// peer's name. A failure is also cached, so that requests to
+// the peer do not each read its registration again, until the
+// peers refresh interval has passed. Must be called with the
+// client's lock held.
+func (c *Client) fetchSchemas(ctx context.Context, peer string) {
+	nsPeer, err := namespaceName(Peers, c.cfg.Namespace, peer)
+	if err != nil {
+		return
+	}
+	peerReg, err := c.registry.FindRegistration(ctx, nsPeer)
+	if err != nil {
+		c.logf("failed fetching schemas of peer: %v, error: %v", peer, err)
+		c.schemas[peer] = &peerSchemas{expires: time.Now().Add(c.cfg.PeersRefreshInterval)}
+		return
+	}
+	c.setSchemas(peer, peerReg)
+}
+
+// checkSchema of the type name against the schemas published by
+// the receiver's peer. Peers which publish no schemas, such as
+// those running older versions of grid, are not checked.
+func (c *Client) checkSchema(nsReceiver, typeName string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ps, ok := c.schemas[c.peers[nsReceiver]]
+	if !ok || len(ps.schemas) == 0 {
+		return nil
+	}
+	remote, ok := ps.schemas[typeName]
+	if !ok {
+		// Test hook.
+		c.cs.Inc(numErrUndecodableMessage)
+		return ErrUndecodableMessage
+	}
+	local, ok := codec.Fingerprint(typeName)
+	if ok && local != remote {
+		// Test hook.
+		c.cs.Inc(numSchemaMismatch)
+		c.logf("schema of message type: %v, differs from receiver: %v", typeName, nsReceiver)
+	}
+	return nil
+}
+
+// PeerSchemas published by the named peer, by message type name.
+// The value is the fingerprint of the type's schema, which can be
+// compared to the local fingerprints from codec.Schemas.
+func (c *Client) PeerSchemas(ctx context.Context, peer string) (map[string]string, error) {
+	nsPeer, err := namespaceName(Peers, c.cfg.Namespace, peer)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := c.registry.FindRegistration(ctx, nsPeer)
+	if err != nil {
+		return nil, err
+	}
+	return reg.Schemas, nil
+}
+
 func (c *Client) deleteAddress(nsReceiver string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -344,7 +532,7 @@ func (c *Client) deleteAddress(nsReceiver string) {
 	// Test hook.
 	c.cs.Inc(numDeleteAddress)
 
-	delete(c.addresses, nsReceiver)
+	c.forgetReceiver(nsReceiver)
 }
 
 func (c *Client) deleteClientAndConn(nsReceiver string, clientID int64) {
@@ -358,7 +546,7 @@ func (c *Client) deleteClientAndConn(nsReceiver string, clientID int64) {
 	if !ok {
 		return
 	}
-	delete(c.addresses, nsReceiver)
+	c.forgetReceiver(nsReceiver)
 
 	ccpool, ok := c.clientsAndConns[address]
 	if !ok {
@@ -371,11 +559,56 @@ func (c *Client) deleteClientAndConn(nsReceiver string, clientID int64) {
 	if clientID != ccpool.id {
 		return
 	}
+	c.forgetPool(address, ccpool)
+}
+
+// forgetReceiver's address and peer, returning the name of
+// the peer, empty if it was not known. Must be called with
+// the client's lock held.
+func (c *Client) forgetReceiver(nsReceiver string) string {
+	peer := c.peers[nsReceiver]
+	delete(c.addresses, nsReceiver)
+	delete(c.peers, nsReceiver)
+	return peer
+}
+
+// forgetPool of the address, closing its connections, along
+// with what the client knows of the address. Must be called
+// with the client's lock held.
+func (c *Client) forgetPool(address string, ccpool *clientAndConnPool) {
 	err := ccpool.close()
 	if err != nil {
-		c.logf("error closing client and connection: %v", err)
+		c.logf("failed closing connections to: %v, error: %v", address, err)
 	}
 	delete(c.clientsAndConns, address)
+	delete(c.accepted, address)
+}
+
+// acceptedCompression of the peer of the receiver, as advertised
+// in the peer's last response, nil if the peer is not yet known.
+func (c *Client) acceptedCompression(nsReceiver string) []Delivery_Compression {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	address, ok := c.addresses[nsReceiver]
+	if !ok {
+		return nil
+	}
+	return c.accepted[address]
+}
+
+// setAcceptedCompression of the peer of the receiver, from the
+// peer's response. Peers running versions of grid which do not
+// advertise compression accept none.
+func (c *Client) setAcceptedCompression(nsReceiver string, accepted []Delivery_Compression) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	address, ok := c.addresses[nsReceiver]
+	if !ok {
+		return
+	}
+	c.accepted[address] = accepted
 }
 
 func (c *Client) logf(format string, v ...interface{}) {
@@ -400,8 +633,33 @@ func (c *Client) BroadcastC(ctx context.Context, g *Group, msg interface{}) (Bro
 }
 
 func (c *Client) broadcast(ctx context.Context, cancel context.CancelFunc, g *Group, msg interface{}) (BroadcastResult, error) {
+	if !g.fastest || len(c.cfg.Locality) == 0 {
+		return c.broadcastTo(ctx, cancel, g, g.Members(), msg)
+	}
+
+	// Prefer the receivers nearest to the client, and
+	// only fall back to the next nearest receivers if
+	// none of the nearer ones responded.
+	res := make(BroadcastResult)
+	var err error
+	for _, tier := range c.byLocality(ctx, g.Members()) {
+		var tierRes BroadcastResult
+		tierRes, err = c.broadcastTo(ctx, cancel, g, tier, msg)
+		res.Add(tierRes)
+		if err == nil {
+			return res, nil
+		}
+		select {
+		case <-ctx.Done():
+			return res, err
+		default:
+		}
+	}
+	return res, err
+}
+
+func (c *Client) broadcastTo(ctx context.Context, cancel context.CancelFunc, g *Group, receivers []string, msg interface{}) (BroadcastResult, error) {
 	res := make(BroadcastResult)
-	receivers := g.Members()
 
 	var broadcastErr error
 	successes := 0
@@ -513,11 +771,18 @@ const (
 	numErrUnregisteredMailbox     statName = "numErrUnregisteredMailbox"
 	numErrUnknownMailbox          statName = "numErrUnknownMailbox"
 	numErrReceiverBusy            statName = "numErrReceiverBusy"
+	numErrServerDraining          statName = "numErrServerDraining"
 	numErrWhileDialing            statName = "numErrWhileDialing"
 	numDeleteAddress              statName = "numDeleteAddress"
 	numDeleteClientAndConn        statName = "numDeleteClientAndConn"
 	numGetWireClient              statName = "numGetWireClient"
 	numGRPCDial                   statName = "numGRPCDial"
+	numErrUndecodableMessage      statName = "numErrUndecodableMessage"
+	numSchemaMismatch             statName = "numSchemaMismatch"
+	numAddressWatchUpdate         statName = "numAddressWatchUpdate"
+	numAddressWatchEvict          statName = "numAddressWatchEvict"
+	numHealthCheckRedial          statName = "numHealthCheckRedial"
+	numHealthCheckClosePool       statName = "numHealthCheckClosePool"
 )
 
 // newClientStats for use during testing.
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/coreos/etcd/clientv3"
+	"github.com/lytics/grid/codec"
 	"github.com/lytics/grid/testetcd"
 )
 
@@ -518,7 +519,104 @@ func TestNilClientStats(t *testing.T) {
 	cs.Inc(numGetWireClient)
 }
 
-func bootstrapClientTest(t *testing.T) (*clientv3.Client, *Server, *Client) {
+func TestClientCheckSchema(t *testing.T) {
+	const nsReceiver = "ns.mailbox.echo"
+
+	typeName, _, err := codec.Marshal(&EchoMsg{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, ok := codec.Fingerprint(typeName)
+	if !ok {
+		t.Fatal("expected fingerprint")
+	}
+
+	client := &Client{
+		peers:   map[string]string{nsReceiver: "localhost-7777"},
+		schemas: map[string]*peerSchemas{},
+		cs:      newClientStats(),
+	}
+
+	// Peer published no schemas.
+	err = client.checkSchema(nsReceiver, typeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Peer cannot decode the type.
+	client.schemas["localhost-7777"] = &peerSchemas{schemas: map[string]string{"other": "0"}}
+	err = client.checkSchema(nsReceiver, typeName)
+	if err != ErrUndecodableMessage {
+		t.Fatal("expected undecodable message error")
+	}
+
+	// Peer has a different schema.
+	client.schemas["localhost-7777"] = &peerSchemas{schemas: map[string]string{typeName: "0"}}
+	err = client.checkSchema(nsReceiver, typeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := client.cs.counters[numSchemaMismatch]; v != 1 {
+		t.Fatal("expected schema mismatch count of 1")
+	}
+
+	// Peer has the same schema.
+	client.schemas["localhost-7777"] = &peerSchemas{schemas: map[string]string{typeName: fingerprint}}
+	err = client.checkSchema(nsReceiver, typeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := client.cs.counters[numSchemaMismatch]; v != 1 {
+		t.Fatal("expected schema mismatch count of 1")
+	}
+}
+
+// BenchmarkClientRequest checks how fast, and with how many
+// allocations, a request makes the round trip to an actor.
+func BenchmarkClientRequest(b *testing.B) {
+	const timeout = 2 * time.Second
+	msg := &EchoMsg{"testing 1, 2, 3"}
+
+	// Bootstrap.
+	etcd, server, client := bootstrapClientTest(b)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	// Create echo actor.
+	a := &echoActor{ready: make(chan bool), server: server}
+	server.RegisterDef("echo", func(_ []byte) (Actor, error) { return a, nil })
+
+	peers, err := client.Query(timeout, Peers)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if len(peers) != 1 {
+		b.Fatal("expected 1 peer")
+	}
+	_, err = client.Request(timeout, peers[0].Name(), NewActorStart("echo"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	<-a.ready
+
+	// Warm the address cache and connection pool.
+	_, err = client.Request(timeout, "echo", msg)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := client.RequestC(context.Background(), "echo", msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func bootstrapClientTest(t testing.TB) (*clientv3.Client, *Server, *Client) {
 	// Namespace for test.
 	namespace := newNamespace()
 
@@ -0,0 +1,83 @@
+// Command grid-migrate moves the keys of a grid namespace in etcd from
+// one root prefix to another, see grid.KeyLayoutVersion and grid.Migrate.
+//
+// Example usage, moving the namespace "acme" from the flat layout to
+// the root prefix "/acme/grid", first as a dry run:
+//
+//     grid-migrate -namespace acme -to /acme/grid -dry-run
+//     grid-migrate -namespace acme -to /acme/grid
+//
+// Then restart the peers and clients of the namespace with the new
+// root prefix. Registrations left under the old layout expire with
+// the peers which made them. With -remove keys are moved instead of
+// copied, which is safe for configs once nothing uses the old layout.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+	"github.com/lytics/grid"
+)
+
+func main() {
+	logger := log.New(os.Stderr, "grid-migrate: ", log.LstdFlags)
+
+	// Exit only once run has returned, so that
+	// its deferred cleanup, such as closing the
+	// etcd client, is done.
+	err := run()
+	if err != nil {
+		logger.Print(err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	endpoints := flag.String("endpoints", "localhost:2379", "comma separated etcd endpoints")
+	namespace := flag.String("namespace", "", "namespace of the grid to migrate")
+	from := flag.String("from", "", "root prefix to migrate from, empty for the flat layout")
+	to := flag.String("to", "", "root prefix to migrate to, empty for the flat layout")
+	remove := flag.Bool("remove", false, "remove the keys from the old root prefix once moved")
+	dryRun := flag.Bool("dry-run", false, "only report which keys would be moved")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of the migration")
+	flag.Parse()
+
+	etcd, err := etcdv3.New(etcdv3.Config{
+		Endpoints:   strings.Split(*endpoints, ","),
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to etcd: %v", err)
+	}
+	defer etcd.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	m, err := grid.Migrate(ctx, etcd, grid.MigrationCfg{
+		Namespace:      *namespace,
+		FromRootPrefix: *from,
+		ToRootPrefix:   *to,
+		Remove:         *remove,
+		DryRun:         *dryRun,
+	})
+	if m != nil {
+		for _, key := range m.Moved {
+			fmt.Printf("moved: %v\n", key)
+		}
+		for _, key := range m.Skipped {
+			fmt.Printf("skipped: %v\n", key)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package codec
+
+import (
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	// maxPooledBuffer is the largest buffer capacity that is
+	// returned to the pool, larger buffers are left to the GC
+	// so that one large message does not pin memory forever.
+	maxPooledBuffer = 64 * 1024
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &Buffer{pb: proto.NewBuffer(nil)}
+	},
+}
+
+// Buffer holding a marshalled message. Buffers returned by
+// MarshalBuffer are pooled, and the Data must not be used
+// after Release is called.
+type Buffer struct {
+	TypeName  string
+	CodecName string
+	Data      []byte
+	pb        *proto.Buffer
+	// pooled if the data is held in the pooled memory.
+	pooled bool
+}
+
+// MarshalBuffer the value into a pooled buffer using the codec
+// the value's type was registered with. Values of types using
+// the Protobuf codec are marshalled into reused memory, other
+// codecs allocate as they do with MarshalCodec. The caller must
+// Release the buffer once the data is no longer used, for
+// example:
+//
+//     buf, err := codec.MarshalBuffer(msg)
+//     if err != nil {
+//         return err
+//     }
+//     defer buf.Release()
+//
+func MarshalBuffer(v interface{}) (*Buffer, error) {
+	r, err := lookupType(v)
+	if err != nil {
+		return nil, err
+	}
+
+	b := bufferPool.Get().(*Buffer)
+	b.TypeName = r.name
+	b.CodecName = r.codec.Name()
+
+	if pb, ok := v.(proto.Message); ok && r.codec == Protobuf {
+		b.pb.Reset()
+		err = b.pb.Marshal(pb)
+		b.Data = b.pb.Bytes()
+		b.pooled = true
+	} else {
+		b.Data, err = r.codec.Marshal(v)
+	}
+	if err != nil {
+		b.Release()
+		return nil, err
+	}
+	return b, nil
+}
+
+// Detach the data from the buffer, returning data which remains
+// valid after Release, which is a copy of the data only if it is
+// held in pooled memory.
+func (b *Buffer) Detach() []byte {
+	if !b.pooled {
+		return b.Data
+	}
+	return append([]byte(nil), b.Data...)
+}
+
+// Release the buffer back to the pool.
+func (b *Buffer) Release() {
+	if b == nil {
+		return
+	}
+	if cap(b.pb.Bytes()) > maxPooledBuffer {
+		b.pb = proto.NewBuffer(nil)
+	}
+	b.TypeName = ""
+	b.CodecName = ""
+	b.Data = nil
+	b.pooled = false
+	bufferPool.Put(b)
+}
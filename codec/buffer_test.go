@@ -0,0 +1,59 @@
+package codec
+
+import (
+	"testing"
+)
+
+type bufferedMsg struct {
+	Name string
+}
+
+func TestMarshalBuffer(t *testing.T) {
+	err := RegisterNameWithCodec("acme.Buffered", bufferedMsg{}, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := MarshalBuffer(&bufferedMsg{Name: "James Tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.TypeName != "acme.Buffered" {
+		t.Fatalf("expected type name: acme.Buffered, got: %v", buf.TypeName)
+	}
+	if buf.CodecName != JSON.Name() {
+		t.Fatalf("expected codec name: %v, got: %v", JSON.Name(), buf.CodecName)
+	}
+
+	res, err := UnmarshalCodec(buf.Data, buf.TypeName, buf.CodecName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Release()
+	if res.(*bufferedMsg).Name != "James Tester" {
+		t.Fatal("expected same name after round trip")
+	}
+}
+
+func TestMarshalBufferUnregistered(t *testing.T) {
+	type unregistered struct{}
+	_, err := MarshalBuffer(&unregistered{})
+	if err != ErrUnregisteredMessageType {
+		t.Fatal("expected unregistered message type error")
+	}
+}
+
+func TestBufferDetach(t *testing.T) {
+	data := []byte("data")
+
+	buf := &Buffer{Data: data}
+	if detached := buf.Detach(); &detached[0] != &data[0] {
+		t.Fatal("expected data which is not pooled to be returned as is")
+	}
+
+	buf = &Buffer{Data: data, pooled: true}
+	detached := buf.Detach()
+	if &detached[0] == &data[0] || string(detached) != "data" {
+		t.Fatal("expected a copy of pooled data")
+	}
+}
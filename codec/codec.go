@@ -0,0 +1,86 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Codec en/decodes the values of the types registered with it.
+// The codec's name is sent along with each message so that the
+// receiver can decode it with the same codec.
+type Codec interface {
+	// Name of the codec, unique among registered codecs.
+	Name() string
+	// Marshal the value into bytes.
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal the bytes into v, which is always a pointer
+	// to a value of the registered type.
+	Unmarshal(buf []byte, v interface{}) error
+}
+
+var (
+	// Protobuf codec, the default, for types implementing proto.Message.
+	Protobuf Codec = protobufCodec{}
+	// JSON codec, using package encoding/json.
+	JSON Codec = jsonCodec{}
+	// Gob codec, using package encoding/gob.
+	Gob Codec = gobCodec{}
+)
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string {
+	return "protobuf"
+}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	pb, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrUnsupportedMessage
+	}
+	return proto.Marshal(pb)
+}
+
+func (protobufCodec) Unmarshal(buf []byte, v interface{}) error {
+	pb, ok := v.(proto.Message)
+	if !ok {
+		return ErrUnsupportedMessage
+	}
+	return proto.Unmarshal(buf, pb)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(buf []byte, v interface{}) error {
+	return json.Unmarshal(buf, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(buf []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(buf)).Decode(v)
+}
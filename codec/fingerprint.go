@@ -0,0 +1,219 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+var messageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// Schemas of all registered types, by type name, including aliases.
+// The value is a fingerprint of the type's structure, two peers with
+// the same fingerprint for a type name have the same definition of
+// the type.
+func Schemas() map[string]string {
+	t := load()
+	schemas := make(map[string]string, len(t.registry))
+	for name, r := range t.registry {
+		schemas[name] = r.fingerprint
+	}
+	return schemas
+}
+
+// Changed returns a channel which is closed once the next type
+// or codec is registered, after which Schemas may differ. Get the
+// channel before calling Schemas, so that no change is missed.
+func Changed() <-chan struct{} {
+	return load().changed
+}
+
+// Fingerprint of the type registered under the given name, or
+// false if no such type is registered.
+func Fingerprint(name string) (string, bool) {
+	r, ok := load().registry[name]
+	if !ok {
+		return "", false
+	}
+	return r.fingerprint, true
+}
+
+// fingerprint of a type registered with the codec. Protobuf messages
+// are described by what is on the wire, the numbers, wire types, and
+// labels of their fields, as generated from the message descriptor
+// into the protobuf struct tags. So messages generated by different
+// versions of protoc-gen-go, or with other json options, have the
+// same fingerprint. Other types are described by the names, tags,
+// and types of their exported fields, recursively.
+func fingerprint(rt reflect.Type, c Codec) string {
+	var buf bytes.Buffer
+	if c == Protobuf && isMessage(rt) {
+		describeMessage(&buf, rt, map[reflect.Type]bool{})
+	} else {
+		describe(&buf, rt, map[reflect.Type]bool{})
+	}
+	h := fnv.New64a()
+	h.Write(buf.Bytes())
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func describe(buf *bytes.Buffer, rt reflect.Type, seen map[reflect.Type]bool) {
+	switch rt.Kind() {
+	case reflect.Ptr:
+		buf.WriteString("*")
+		describe(buf, rt.Elem(), seen)
+	case reflect.Slice:
+		buf.WriteString("[]")
+		describe(buf, rt.Elem(), seen)
+	case reflect.Array:
+		fmt.Fprintf(buf, "[%d]", rt.Len())
+		describe(buf, rt.Elem(), seen)
+	case reflect.Map:
+		buf.WriteString("map[")
+		describe(buf, rt.Key(), seen)
+		buf.WriteString("]")
+		describe(buf, rt.Elem(), seen)
+	case reflect.Struct:
+		// Recursive types are described
+		// by name after the first visit.
+		if seen[rt] {
+			buf.WriteString(rt.Name())
+			return
+		}
+		seen[rt] = true
+		buf.WriteString("struct{")
+		for i := 0; i < rt.NumField(); i++ {
+			f := rt.Field(i)
+			if f.PkgPath != "" {
+				// Unexported.
+				continue
+			}
+			fmt.Fprintf(buf, "%s %q ", f.Name, f.Tag)
+			describe(buf, f.Type, seen)
+			buf.WriteString(";")
+		}
+		buf.WriteString("}")
+	default:
+		buf.WriteString(rt.Kind().String())
+	}
+}
+
+// isMessage returns true if pointers to the struct type are
+// protobuf messages.
+func isMessage(rt reflect.Type) bool {
+	return rt.Kind() == reflect.Struct && reflect.PtrTo(rt).Implements(messageType)
+}
+
+// describeMessage of the protobuf message struct type. Fields
+// generated for the runtime, named XXX_, are not on the wire.
+func describeMessage(buf *bytes.Buffer, rt reflect.Type, seen map[reflect.Type]bool) {
+	if seen[rt] {
+		buf.WriteString(rt.Name())
+		return
+	}
+	seen[rt] = true
+	buf.WriteString("message{")
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if strings.HasPrefix(f.Name, "XXX_") {
+			continue
+		}
+		tag := f.Tag.Get("protobuf")
+		if tag == "" {
+			// Oneofs are described below, by
+			// their fields.
+			continue
+		}
+		describeField(buf, f, tag, seen)
+	}
+
+	// The fields of oneofs are those of the wrapper
+	// types of the oneof, in order of field number.
+	var oneofs []*proto.OneofProperties
+	for _, o := range proto.GetProperties(rt).OneofTypes {
+		oneofs = append(oneofs, o)
+	}
+	sort.Slice(oneofs, func(i, j int) bool {
+		return oneofs[i].Prop.Tag < oneofs[j].Prop.Tag
+	})
+	for _, o := range oneofs {
+		wrapper := o.Type
+		if wrapper.Kind() == reflect.Ptr {
+			wrapper = wrapper.Elem()
+		}
+		if wrapper.Kind() != reflect.Struct || wrapper.NumField() != 1 {
+			continue
+		}
+		f := wrapper.Field(0)
+		buf.WriteString("oneof ")
+		describeField(buf, f, f.Tag.Get("protobuf"), seen)
+	}
+	buf.WriteString("}")
+}
+
+// describeField of a protobuf message, by the wire type, number,
+// label, and enum of its protobuf tag, and its type. Options which
+// do not change the wire format, such as names and json names, are
+// left out.
+func describeField(buf *bytes.Buffer, f reflect.StructField, tag string, seen map[reflect.Type]bool) {
+	buf.WriteString(wireOptions(tag))
+	if f.Type.Kind() == reflect.Map {
+		buf.WriteString(" map<")
+		buf.WriteString(wireOptions(f.Tag.Get("protobuf_key")))
+		buf.WriteString(" ")
+		describeFieldType(buf, f.Type.Key(), seen)
+		buf.WriteString(",")
+		buf.WriteString(wireOptions(f.Tag.Get("protobuf_val")))
+		buf.WriteString(" ")
+		describeFieldType(buf, f.Type.Elem(), seen)
+		buf.WriteString(">;")
+		return
+	}
+	buf.WriteString(" ")
+	describeFieldType(buf, f.Type, seen)
+	buf.WriteString(";")
+}
+
+// wireOptions of a protobuf struct tag, such as:
+//
+//     varint,6,opt,name=compression,enum=grid.Delivery_Compression
+//
+// which are the wire type, number, label, and enum.
+func wireOptions(tag string) string {
+	var options []string
+	for i, option := range strings.Split(tag, ",") {
+		if i < 3 || strings.HasPrefix(option, "enum=") {
+			options = append(options, option)
+		}
+	}
+	return strings.Join(options, ",")
+}
+
+// describeFieldType of a protobuf message field, whose label
+// already tells if it is repeated, so slices other than bytes
+// are described by their element type.
+func describeFieldType(buf *bytes.Buffer, rt reflect.Type, seen map[reflect.Type]bool) {
+	switch rt.Kind() {
+	case reflect.Ptr:
+		describeFieldType(buf, rt.Elem(), seen)
+	case reflect.Slice:
+		if rt.Elem().Kind() == reflect.Uint8 {
+			buf.WriteString("bytes")
+			return
+		}
+		describeFieldType(buf, rt.Elem(), seen)
+	case reflect.Struct:
+		if isMessage(rt) {
+			describeMessage(buf, rt, seen)
+			return
+		}
+		describe(buf, rt, seen)
+	default:
+		buf.WriteString(rt.Kind().String())
+	}
+}
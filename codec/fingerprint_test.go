@@ -0,0 +1,151 @@
+package codec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lytics/grid/codec/protomessage"
+)
+
+type schemaV1 struct {
+	Name string `json:"name"`
+}
+
+type schemaV2 struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type schemaTree struct {
+	Value    int
+	Children []*schemaTree
+}
+
+func TestFingerprint(t *testing.T) {
+	err := RegisterNameWithCodec("acme.SchemaV1", schemaV1{}, JSON, "acme.OldSchemaV1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RegisterNameWithCodec("acme.SchemaV2", schemaV2{}, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v1, ok := Fingerprint("acme.SchemaV1")
+	if !ok {
+		t.Fatal("expected fingerprint")
+	}
+	v2, ok := Fingerprint("acme.SchemaV2")
+	if !ok {
+		t.Fatal("expected fingerprint")
+	}
+	if v1 == v2 {
+		t.Fatal("expected different fingerprints for different schemas")
+	}
+
+	schemas := Schemas()
+	if schemas["acme.SchemaV1"] != v1 {
+		t.Fatal("expected schemas to contain type name")
+	}
+	if schemas["acme.OldSchemaV1"] != v1 {
+		t.Fatal("expected schemas to contain alias")
+	}
+
+	_, ok = Fingerprint("acme.Unknown")
+	if ok {
+		t.Fatal("expected no fingerprint for unknown type")
+	}
+}
+
+func TestFingerprintStable(t *testing.T) {
+	err := RegisterNameWithCodec("acme.SchemaTree", schemaTree{}, Gob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := Fingerprint("acme.SchemaTree")
+	err = RegisterNameWithCodec("acme.SchemaTree", schemaTree{}, Gob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := Fingerprint("acme.SchemaTree")
+	if a == "" || a != b {
+		t.Fatalf("expected stable fingerprint, got: %v and %v", a, b)
+	}
+}
+
+type schemaLate struct {
+	Name string
+}
+
+func TestChanged(t *testing.T) {
+	changed := Changed()
+	select {
+	case <-changed:
+		t.Fatal("expected no change")
+	default:
+	}
+
+	err := RegisterNameWithCodec("acme.SchemaLate", schemaLate{}, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Fatal("expected change once a type is registered")
+	}
+	if _, ok := Schemas()["acme.SchemaLate"]; !ok {
+		t.Fatal("expected schemas to contain the new type")
+	}
+	select {
+	case <-Changed():
+		t.Fatal("expected no further change")
+	default:
+	}
+}
+
+// schemaPerson is protomessage.Person as generated by a newer
+// protoc-gen-go, with json names for its fields.
+type schemaPerson struct {
+	Name                 string                             `protobuf:"bytes,1,opt,name=name,json=fullName,proto3" json:"fullName,omitempty"`
+	Email                string                             `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	Phones               []*protomessage.Person_PhoneNumber `protobuf:"bytes,4,rep,name=phones,proto3" json:"phones,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                           `json:"-"`
+	XXX_unrecognized     []byte                             `json:"-"`
+	XXX_sizecache        int32                              `json:"-"`
+}
+
+func (m *schemaPerson) Reset()         { *m = schemaPerson{} }
+func (m *schemaPerson) String() string { return proto.CompactTextString(m) }
+func (*schemaPerson) ProtoMessage()    {}
+
+// schemaPersonRenumbered is protomessage.Person with the
+// email in another field.
+type schemaPersonRenumbered struct {
+	Name   string                             `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Email  string                             `protobuf:"bytes,3,opt,name=email" json:"email,omitempty"`
+	Phones []*protomessage.Person_PhoneNumber `protobuf:"bytes,4,rep,name=phones" json:"phones,omitempty"`
+}
+
+func (m *schemaPersonRenumbered) Reset()         { *m = schemaPersonRenumbered{} }
+func (m *schemaPersonRenumbered) String() string { return proto.CompactTextString(m) }
+func (*schemaPersonRenumbered) ProtoMessage()    {}
+
+func TestFingerprintProtobuf(t *testing.T) {
+	person := fingerprint(reflect.TypeOf(protomessage.Person{}), Protobuf)
+
+	// Fields for the runtime, and json options, are not
+	// on the wire, so do not change the fingerprint.
+	if regenerated := fingerprint(reflect.TypeOf(schemaPerson{}), Protobuf); regenerated != person {
+		t.Fatalf("expected same fingerprint, got: %v and %v", person, regenerated)
+	}
+	if renumbered := fingerprint(reflect.TypeOf(schemaPersonRenumbered{}), Protobuf); renumbered == person {
+		t.Fatal("expected different fingerprint for different field numbers")
+	}
+
+	// Registered with another codec, the json options matter.
+	if fingerprint(reflect.TypeOf(schemaPerson{}), JSON) == fingerprint(reflect.TypeOf(protomessage.Person{}), JSON) {
+		t.Fatal("expected different fingerprint for different json names")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"reflect"
 	"sync"
+	"sync/atomic"
 
 	"github.com/golang/protobuf/proto"
 )
@@ -15,16 +16,164 @@ var (
 	// ErrUnregisteredMessageType when a unregistered type is called
 	// for marshalling or unmarshalling.
 	ErrUnregisteredMessageType = errors.New("codec: unregistered message type")
+	// ErrUnknownCodec when a message names a codec which has
+	// never been registered.
+	ErrUnknownCodec = errors.New("codec: unknown codec")
+	// ErrInvalidCodec when a nil codec or a codec without a
+	// name is registered.
+	ErrInvalidCodec = errors.New("codec: invalid codec")
+	// ErrInvalidTypeName when a type is registered with an empty
+	// name, or without a name and it is not a protobuf message.
+	ErrInvalidTypeName = errors.New("codec: invalid type name")
+	// ErrTypeNameConflict when a name or alias is registered which
+	// already names a different type.
+	ErrTypeNameConflict = errors.New("codec: type name conflict")
+	// ErrInvalidConstructor when a type is registered whose
+	// Constructor returns a value of another type than a
+	// pointer to the type.
+	ErrInvalidConstructor = errors.New("codec: invalid constructor")
 )
 
+// Constructor of new values of a message type, which message types
+// can implement so that decoding them uses no reflection. The value
+// returned must be a pointer to a new zero value of the type:
+//
+//     func (Person) NewMessage() interface{} { return &Person{} }
+//
+// Decoding types which do not implement it uses reflection to
+// create their values.
+type Constructor interface {
+	NewMessage() interface{}
+}
+
+// registration of a type, the name it is sent under,
+// and the codec used for it.
+type registration struct {
+	name        string
+	rt          reflect.Type
+	codec       Codec
+	fingerprint string
+	// new value of the type, the constructor is captured
+	// at registration, see Constructor.
+	new func() interface{}
+}
+
+// table of registrations. A table is never modified once it
+// is published, registering copies the current table, so the
+// marshal and unmarshal paths can read it without locking.
+type table struct {
+	registry map[string]*registration
+	types    map[reflect.Type]*registration
+	codecs   map[string]Codec
+	// changed is closed once the table is replaced.
+	changed chan struct{}
+}
+
+func (t *table) clone() *table {
+	c := &table{
+		registry: make(map[string]*registration, len(t.registry)+1),
+		types:    make(map[reflect.Type]*registration, len(t.types)+1),
+		codecs:   make(map[string]Codec, len(t.codecs)+1),
+		changed:  make(chan struct{}),
+	}
+	for k, v := range t.registry {
+		c.registry[k] = v
+	}
+	for k, v := range t.types {
+		c.types[k] = v
+	}
+	for k, v := range t.codecs {
+		c.codecs[k] = v
+	}
+	return c
+}
+
 var (
-	mu       = &sync.RWMutex{}
-	registry = map[string]interface{}{}
+	// mu serializes registrations, readers use current.
+	mu      = &sync.Mutex{}
+	current atomic.Value
 )
 
+func init() {
+	current.Store(&table{
+		registry: map[string]*registration{},
+		types:    map[reflect.Type]*registration{},
+		codecs: map[string]Codec{
+			Protobuf.Name(): Protobuf,
+			JSON.Name():     JSON,
+			Gob.Name():      Gob,
+		},
+		changed: make(chan struct{}),
+	})
+}
+
+func load() *table {
+	return current.Load().(*table)
+}
+
+// store the table, replacing the current one, must be
+// called with mu held.
+func store(t *table) {
+	prev := load()
+	current.Store(t)
+	close(prev.changed)
+}
+
+// constructor of new values of the type, the type's own if it
+// implements Constructor, otherwise one using reflection. The
+// type's value v and a pointer to a value pv are both checked,
+// since the constructor's receiver can be either.
+func constructor(rt reflect.Type, v, pv interface{}) (func() interface{}, error) {
+	c, ok := v.(Constructor)
+	if !ok {
+		c, ok = pv.(Constructor)
+	}
+	if !ok {
+		return func() interface{} {
+			return reflect.New(rt).Interface()
+		}, nil
+	}
+	if reflect.TypeOf(c.NewMessage()) != reflect.PtrTo(rt) {
+		return nil, ErrInvalidConstructor
+	}
+	return c.NewMessage, nil
+}
+
 // Register a type for marshalling and unmarshalling.
 // The type must currently implement proto.Message.
 func Register(v interface{}) error {
+	return RegisterWithCodec(v, Protobuf)
+}
+
+// RegisterWithCodec a type for marshalling and unmarshalling
+// with the given codec. If the codec is Protobuf the type must
+// implement proto.Message. The codec itself is also registered
+// by name, so that messages naming it can be decoded.
+func RegisterWithCodec(v interface{}, c Codec) error {
+	return RegisterNameWithCodec(TypeName(v), v, c)
+}
+
+// RegisterName of a type for marshalling and unmarshalling. The
+// name is sent with each message instead of the name returned by
+// TypeName, so the type can move between Go packages without
+// breaking compatibility between peers. If the name is empty the
+// protobuf full message name is used, for example "grid.Ack".
+// Messages sent under any of the aliases are also decoded into
+// the type, which allows renaming types, for example:
+//
+//     RegisterName("", msg.Person{}, "github.com/acme/app/msg/Person")
+//
+func RegisterName(name string, v interface{}, aliases ...string) error {
+	return RegisterNameWithCodec(name, v, Protobuf, aliases...)
+}
+
+// RegisterNameWithCodec of a type for marshalling and unmarshalling
+// with the given codec. See RegisterName and RegisterWithCodec.
+func RegisterNameWithCodec(name string, v interface{}, c Codec, aliases ...string) error {
+	if c == nil || c.Name() == "" {
+		return ErrInvalidCodec
+	}
+
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -32,48 +181,128 @@ func Register(v interface{}) error {
 	// as a pointer type, but to check if
 	// it is a proto message, the pointer
 	// type must be checked.
-	pv := reflect.New(reflect.TypeOf(v)).Interface()
-
-	_, ok := pv.(proto.Message)
-	if !ok {
+	rt := reflect.TypeOf(v)
+	pv := reflect.New(rt).Interface()
+	pb, isProto := pv.(proto.Message)
+	if c.Name() == Protobuf.Name() && !isProto {
 		return ErrUnsupportedMessage
 	}
+	if name == "" && isProto {
+		name = proto.MessageName(pb)
+	}
+	if name == "" {
+		return ErrInvalidTypeName
+	}
+	t := load()
+	for _, n := range append([]string{name}, aliases...) {
+		if n == "" {
+			return ErrInvalidTypeName
+		}
+		if r, ok := t.registry[n]; ok && r.rt != rt {
+			return ErrTypeNameConflict
+		}
+	}
+
+	newValue, err := constructor(rt, v, pv)
+	if err != nil {
+		return err
+	}
+	r := &registration{
+		name:        name,
+		rt:          rt,
+		codec:       c,
+		fingerprint: fingerprint(rt, c),
+		new:         newValue,
+	}
+	t = t.clone()
+	t.registry[name] = r
+	for _, alias := range aliases {
+		t.registry[alias] = r
+	}
+	t.types[rt] = r
+	t.codecs[c.Name()] = c
+	store(t)
+	return nil
+}
+
+// RegisterCodec by name, so that messages encoded with it can be
+// decoded, even if no local type is registered with it.
+func RegisterCodec(c Codec) error {
+	if c == nil || c.Name() == "" {
+		return ErrInvalidCodec
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
 
-	name := TypeName(v)
-	registry[name] = v
+	t := load().clone()
+	t.codecs[c.Name()] = c
+	store(t)
 	return nil
 }
 
 // Marshal the value into bytes. The function returns
 // the type name, the bytes, or an error.
 func Marshal(v interface{}) (string, []byte, error) {
-	mu.RLock()
-	defer mu.RUnlock()
+	name, _, buf, err := MarshalCodec(v)
+	return name, buf, err
+}
 
-	name := TypeName(v)
-	_, ok := registry[name]
-	if !ok {
-		return "", nil, ErrUnregisteredMessageType
+// MarshalCodec the value into bytes using the codec the
+// value's type was registered with. The function returns
+// the type name, the codec name, the bytes, or an error.
+func MarshalCodec(v interface{}) (string, string, []byte, error) {
+	r, err := lookupType(v)
+	if err != nil {
+		return "", "", nil, err
 	}
-	buf, err := protoMarshal(v)
+	buf, err := r.codec.Marshal(v)
 	if err != nil {
-		return "", nil, err
+		return "", "", nil, err
 	}
-	return name, buf, nil
+	return r.name, r.codec.Name(), buf, nil
+}
+
+// lookupType of the value, which may be a pointer
+// to the registered type.
+func lookupType(v interface{}) (*registration, error) {
+	rt := reflect.TypeOf(v)
+	if rt != nil && rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	r, ok := load().types[rt]
+	if !ok {
+		return nil, ErrUnregisteredMessageType
+	}
+	return r, nil
 }
 
 // Unmarshal the bytes into a value whos type is given,
 // or return an error.
 func Unmarshal(buf []byte, name string) (interface{}, error) {
-	mu.RLock()
-	defer mu.RUnlock()
+	return UnmarshalCodec(buf, name, "")
+}
 
-	c, ok := registry[name]
+// UnmarshalCodec the bytes into a value whos type is given,
+// using the named codec, or return an error. An empty codec
+// name means the codec the type was registered with. The type
+// name can be the name the type was registered under, or any
+// of its aliases.
+func UnmarshalCodec(buf []byte, name, codecName string) (interface{}, error) {
+	t := load()
+	r, ok := t.registry[name]
 	if !ok {
 		return nil, ErrUnregisteredMessageType
 	}
-	v := reflect.New(reflect.TypeOf(c)).Interface()
-	err := protoUnmarshal(buf, v)
+	c := r.codec
+	if codecName != "" && codecName != c.Name() {
+		c, ok = t.codecs[codecName]
+		if !ok {
+			return nil, ErrUnknownCodec
+		}
+	}
+	v := r.new()
+	err := c.Unmarshal(buf, v)
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +310,8 @@ func Unmarshal(buf []byte, name string) (interface{}, error) {
 }
 
 // TypeName of a value. This name is used in the registry
-// to distinguish types.
+// to distinguish types, unless the type is registered with
+// an explicit name, see RegisterName.
 func TypeName(v interface{}) string {
 	rt := reflect.TypeOf(v)
 	pkg := rt.PkgPath()
@@ -93,13 +323,3 @@ func TypeName(v interface{}) string {
 	}
 	return pkg + "/" + name
 }
-
-func protoMarshal(v interface{}) ([]byte, error) {
-	pb := v.(proto.Message)
-	return proto.Marshal(pb)
-}
-
-func protoUnmarshal(buf []byte, v interface{}) error {
-	pb := v.(proto.Message)
-	return proto.Unmarshal(buf, pb)
-}
@@ -63,6 +63,190 @@ func TestNonProtobuf(t *testing.T) {
 	}
 }
 
+type plainMsg struct {
+	Name  string
+	Count int
+}
+
+func TestRegisterWithCodec(t *testing.T) {
+	for _, c := range []Codec{JSON, Gob} {
+		err := RegisterWithCodec(plainMsg{}, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg := &plainMsg{Name: "James Tester", Count: 7}
+		typeName, codecName, data, err := MarshalCodec(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codecName != c.Name() {
+			t.Fatalf("expected codec: %v, got: %v", c.Name(), codecName)
+		}
+
+		res, err := UnmarshalCodec(data, typeName, codecName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch res := res.(type) {
+		case *plainMsg:
+			if *res != *msg {
+				t.Fatalf("expected: %v, got: %v", msg, res)
+			}
+		default:
+			t.Fatalf("expected type: *plainMsg, got: %T", res)
+		}
+	}
+}
+
+func TestUnmarshalWithSenderCodec(t *testing.T) {
+	// Sender encoded with JSON, but the receiver
+	// registered the type with gob.
+	err := RegisterWithCodec(plainMsg{}, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeName, codecName, data, err := MarshalCodec(&plainMsg{Name: "James Tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = RegisterWithCodec(plainMsg{}, Gob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := UnmarshalCodec(data, typeName, codecName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.(*plainMsg).Name != "James Tester" {
+		t.Fatal("expected same name")
+	}
+}
+
+func TestUnmarshalUnknownCodec(t *testing.T) {
+	err := RegisterWithCodec(plainMsg{}, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = UnmarshalCodec([]byte("{}"), TypeName(plainMsg{}), "unknown")
+	if err != ErrUnknownCodec {
+		t.Fatal("expected unknown codec error")
+	}
+}
+
+func TestRegisterInvalidCodec(t *testing.T) {
+	err := RegisterWithCodec(plainMsg{}, nil)
+	if err != ErrInvalidCodec {
+		t.Fatal("expected invalid codec error")
+	}
+	err = RegisterWithCodec(plainMsg{}, Protobuf)
+	if err != ErrUnsupportedMessage {
+		t.Fatal("expected unsupported message error")
+	}
+}
+
+type renamedMsg struct {
+	Name string
+}
+
+func TestRegisterNameWithAliases(t *testing.T) {
+	const (
+		name  = "acme.Renamed"
+		alias = "github.com/acme/old/Renamed"
+	)
+
+	err := RegisterNameWithCodec(name, renamedMsg{}, JSON, alias)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	typeName, codecName, data, err := MarshalCodec(&renamedMsg{Name: "James Tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typeName != name {
+		t.Fatalf("expected type name: %v, got: %v", name, typeName)
+	}
+
+	// Messages sent by an old build under
+	// the alias decode into the same type.
+	for _, n := range []string{name, alias} {
+		res, err := UnmarshalCodec(data, n, codecName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.(*renamedMsg).Name != "James Tester" {
+			t.Fatal("expected same name")
+		}
+	}
+}
+
+func TestRegisterNameConflict(t *testing.T) {
+	err := RegisterNameWithCodec("acme.Conflict", renamedMsg{}, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RegisterNameWithCodec("acme.Conflict", plainMsg{}, JSON)
+	if err != ErrTypeNameConflict {
+		t.Fatal("expected type name conflict error")
+	}
+	err = RegisterNameWithCodec("acme.Other", plainMsg{}, JSON, "acme.Conflict")
+	if err != ErrTypeNameConflict {
+		t.Fatal("expected type name conflict error")
+	}
+}
+
+func TestRegisterNameEmpty(t *testing.T) {
+	err := RegisterNameWithCodec("", plainMsg{}, JSON)
+	if err != ErrInvalidTypeName {
+		t.Fatal("expected invalid type name error")
+	}
+}
+
+type constructedMsg struct {
+	Name string
+}
+
+var constructed int
+
+func (constructedMsg) NewMessage() interface{} {
+	constructed++
+	return &constructedMsg{}
+}
+
+type misconstructedMsg struct{}
+
+func (misconstructedMsg) NewMessage() interface{} { return &plainMsg{} }
+
+func TestRegisterConstructor(t *testing.T) {
+	err := RegisterNameWithCodec("acme.Constructed", constructedMsg{}, JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeName, codecName, data, err := MarshalCodec(&constructedMsg{Name: "James Tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := constructed
+	res, err := UnmarshalCodec(data, typeName, codecName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if constructed != before+1 {
+		t.Fatal("expected the type's constructor to be used")
+	}
+	if res.(*constructedMsg).Name != "James Tester" {
+		t.Fatal("expected same name after round trip")
+	}
+
+	err = RegisterNameWithCodec("acme.Misconstructed", misconstructedMsg{}, JSON)
+	if err != ErrInvalidConstructor {
+		t.Fatalf("expected error: %v, got: %v", ErrInvalidConstructor, err)
+	}
+}
+
 // BenchmarkMarshal checks how fast it is to look up
 // a type in the registry and marshal.
 //
@@ -79,6 +263,7 @@ func BenchmarkMarshal(b *testing.B) {
 		Name: "James Tester",
 	}
 
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		_, data, err := Marshal(msg)
 		if err != nil {
@@ -110,6 +295,7 @@ func BenchmarkUnmarshal(b *testing.B) {
 		b.Fatal(err)
 	}
 
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		res, err := Unmarshal(data, typeName)
 		if err != nil {
@@ -120,3 +306,28 @@ func BenchmarkUnmarshal(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkMarshalBuffer checks how fast it is to look up
+// a type in the registry and marshal into a pooled buffer.
+func BenchmarkMarshalBuffer(b *testing.B) {
+	err := Register(protomessage.Person{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	msg := &protomessage.Person{
+		Name: "James Tester",
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := MarshalBuffer(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(buf.Data) == 0 {
+			b.Fatal("marshal produced zero bytes")
+		}
+		buf.Release()
+	}
+}
@@ -0,0 +1,102 @@
+package grid
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// defaultMaxMessageSize of gRPC, which bounds decompressed
+// data when the config leaves MaxMessageSize at zero.
+const defaultMaxMessageSize = 4 << 20
+
+var (
+	gzipWriters = sync.Pool{
+		New: func() interface{} {
+			return gzip.NewWriter(nil)
+		},
+	}
+)
+
+// compress the data if it is at least threshold bytes long and
+// the compression is accepted. A threshold of zero or less means
+// the data is never compressed. The data and the compression
+// actually applied are returned.
+func compress(data []byte, threshold int, accepted []Delivery_Compression) ([]byte, Delivery_Compression, error) {
+	if threshold <= 0 || len(data) < threshold || !acceptsCompression(accepted, Delivery_Gzip) {
+		return data, Delivery_None, nil
+	}
+
+	var buf bytes.Buffer
+	w := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(w)
+	w.Reset(&buf)
+	_, err := w.Write(data)
+	if err != nil {
+		return nil, Delivery_None, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, Delivery_None, err
+	}
+
+	// Compression is not worth it if
+	// the data did not get smaller.
+	if buf.Len() >= len(data) {
+		return data, Delivery_None, nil
+	}
+	return buf.Bytes(), Delivery_Gzip, nil
+}
+
+// decompress the data according to the compression flag
+// of the delivery it was received in. Data decompressing to
+// more than maxSize bytes, or the default message size of
+// gRPC if maxSize is zero or less, is refused with the error
+// ErrMessageTooLarge.
+func decompress(data []byte, c Delivery_Compression, maxSize int) ([]byte, error) {
+	switch c {
+	case Delivery_None:
+		return data, nil
+	case Delivery_Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		if maxSize <= 0 {
+			maxSize = defaultMaxMessageSize
+		}
+		// Read one byte past the limit to
+		// tell if the limit was exceeded.
+		res, err := ioutil.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(res) > maxSize {
+			return nil, ErrMessageTooLarge
+		}
+		return res, nil
+	default:
+		return nil, ErrUnsupportedCompression
+	}
+}
+
+// acceptsCompression returns true if c is in the list of
+// accepted compressions. No compression is always accepted.
+func acceptsCompression(accepted []Delivery_Compression, c Delivery_Compression) bool {
+	if c == Delivery_None {
+		return true
+	}
+	for _, a := range accepted {
+		if a == c {
+			return true
+		}
+	}
+	return false
+}
+
+// supportedCompression lists the compressions this
+// version of grid can decompress.
+var supportedCompression = []Delivery_Compression{Delivery_Gzip}
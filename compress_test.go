@@ -0,0 +1,103 @@
+package grid
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("grid compression "), 1000)
+
+	compressed, c, err := compress(data, 1024, supportedCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != Delivery_Gzip {
+		t.Fatalf("expected gzip compression, got: %v", c)
+	}
+	if len(compressed) >= len(data) {
+		t.Fatal("expected compressed data to be smaller")
+	}
+
+	res, err := decompress(compressed, c, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, data) {
+		t.Fatal("expected same data after decompression")
+	}
+}
+
+func TestCompressBelowThreshold(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 100)
+
+	res, c, err := compress(data, 1024, supportedCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != Delivery_None {
+		t.Fatalf("expected no compression, got: %v", c)
+	}
+	if !bytes.Equal(res, data) {
+		t.Fatal("expected same data")
+	}
+}
+
+func TestCompressNotAccepted(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 2048)
+
+	_, c, err := compress(data, 1024, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != Delivery_None {
+		t.Fatalf("expected no compression, got: %v", c)
+	}
+}
+
+func TestDecompressUnsupported(t *testing.T) {
+	_, err := decompress([]byte("data"), Delivery_Compression(99), 0)
+	if err != ErrUnsupportedCompression {
+		t.Fatal("expected unsupported compression error")
+	}
+}
+
+func TestDecompressTooLarge(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 2048)
+
+	compressed, c, err := compress(data, 1024, supportedCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = decompress(compressed, c, len(data)-1)
+	if err != ErrMessageTooLarge {
+		t.Fatalf("expected error: %v, got: %v", ErrMessageTooLarge, err)
+	}
+	res, err := decompress(compressed, c, len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, data) {
+		t.Fatal("expected same data after decompression")
+	}
+}
+
+func TestRespondWithCompression(t *testing.T) {
+	req := &request{
+		response:             make(chan *Delivery, 1),
+		compressionThreshold: 64,
+		acceptCompression:    supportedCompression,
+	}
+	msg := &EchoMsg{Msg: string(bytes.Repeat([]byte("echo "), 100))}
+	err := req.Respond(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := <-req.response
+	if res.Compression != Delivery_Gzip {
+		t.Fatalf("expected gzip compression, got: %v", res.Compression)
+	}
+	if !acceptsCompression(res.AcceptCompression, Delivery_Gzip) {
+		t.Fatal("expected response to advertise gzip")
+	}
+}
@@ -0,0 +1,255 @@
+package grid
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lytics/grid/codec"
+	"github.com/lytics/grid/registry"
+)
+
+const (
+	// configs entity, which is not queryable, but
+	// is namespaced like the others.
+	configs EntityType = "config"
+)
+
+// configValue as stored in etcd, the value encoded with
+// the codec its type was registered with.
+type configValue struct {
+	TypeName  string `json:"type"`
+	CodecName string `json:"codec"`
+	Data      []byte `json:"data"`
+}
+
+// ConfigEvent of a watched config value.
+type ConfigEvent struct {
+	name string
+	err  error
+	// Value of the config after the change, nil if the
+	// config was deleted.
+	Value interface{}
+	// Revision of the value, used with CompareAndSwapConfig.
+	Revision int64
+}
+
+// Name of the config.
+func (e *ConfigEvent) Name() string {
+	return e.name
+}
+
+// Err caught watching the config, or decoding its value.
+// Errors of the watch itself are followed by the channel
+// closing.
+func (e *ConfigEvent) Err() error {
+	return e.err
+}
+
+// String representation of config event.
+func (e *ConfigEvent) String() string {
+	if e == nil {
+		return "config event: <nil>"
+	}
+	if e.err != nil {
+		return fmt.Sprintf("config event: %v: error: %v", e.name, e.err)
+	}
+	if e.Value == nil {
+		return fmt.Sprintf("config event: %v deleted", e.name)
+	}
+	return fmt.Sprintf("config event: %v changed, revision: %v", e.name, e.Revision)
+}
+
+// GetConfig named in this client's namespace, and its revision.
+// If the config has no value ErrUnknownConfig is returned. Config
+// values are messages, so their types must be registered, see
+// Register.
+func (c *Client) GetConfig(ctx context.Context, name string) (interface{}, int64, error) {
+	nsName, err := namespaceName(configs, c.cfg.Namespace, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	value, err := c.registry.GetValue(ctx, nsName)
+	if err == registry.ErrUnknownKey {
+		return nil, 0, ErrUnknownConfig
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	v, err := decodeConfig(value.Data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, value.Revision, nil
+}
+
+// PutConfig named in this client's namespace, replacing any value,
+// and return the new revision. Config values are stored apart from
+// registrations and are not bound to the lease of any peer.
+//
+// Example usage:
+//
+//     grid.Register(RateLimit{})
+//     ...
+//     rev, err := client.PutConfig(ctx, "rate-limit", &RateLimit{PerSecond: 100})
+//
+func (c *Client) PutConfig(ctx context.Context, name string, v interface{}) (int64, error) {
+	nsName, data, err := c.encodeConfig(name, v)
+	if err != nil {
+		return 0, err
+	}
+	value, err := c.registry.PutValue(ctx, nsName, data)
+	if err != nil {
+		return 0, err
+	}
+	return value.Revision, nil
+}
+
+// CompareAndSwapConfig named in this client's namespace, only if
+// its revision is still the given revision, and return the new
+// revision. Use a revision of zero to put a config which must not
+// have a value yet. If the config has changed ErrConfigChanged is
+// returned.
+func (c *Client) CompareAndSwapConfig(ctx context.Context, name string, v interface{}, revision int64) (int64, error) {
+	nsName, data, err := c.encodeConfig(name, v)
+	if err != nil {
+		return 0, err
+	}
+	value, err := c.registry.CompareAndSwapValue(ctx, nsName, data, revision)
+	if err == registry.ErrValueChanged {
+		return 0, ErrConfigChanged
+	}
+	if err != nil {
+		return 0, err
+	}
+	return value.Revision, nil
+}
+
+// DeleteConfig named in this client's namespace.
+func (c *Client) DeleteConfig(ctx context.Context, name string) error {
+	nsName, err := namespaceName(configs, c.cfg.Namespace, name)
+	if err != nil {
+		return err
+	}
+	return c.registry.DeleteValue(ctx, nsName)
+}
+
+// WatchConfig named in this client's namespace. The current value
+// is returned, with a nil Value if the config has none, and each
+// change is put on the channel.
+//
+// Example usage:
+//
+//     current, watch, err := client.WatchConfig(ctx, "rate-limit")
+//     ...
+//     limit, _ := current.Value.(*RateLimit)
+//
+//     for event := range watch {
+//         if event.Err() != nil {
+//             // Error occured watching config, deal with error.
+//         }
+//         if limit, ok := event.Value.(*RateLimit); ok {
+//             // Apply the new limit.
+//         }
+//     }
+//
+// Like QueryWatch, the watch resumes after errors of the
+// underlying etcd watch, and an error is only sent once
+// resumption has failed repeatedly. Watches of the same config
+// share one etcd watch, and one whose buffer is full is dealt
+// with according to the client's SlowWatcherPolicy.
+func (c *Client) WatchConfig(ctx context.Context, name string) (*ConfigEvent, <-chan *ConfigEvent, error) {
+	nsName, err := namespaceName(configs, c.cfg.Namespace, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	value, changes, err := c.registry.WatchValue(ctx, nsName)
+	if err != nil {
+		return nil, nil, err
+	}
+	current := newConfigEvent(name, value)
+	if current.err != nil {
+		return nil, nil, current.err
+	}
+
+	configEvents := make(chan *ConfigEvent)
+	put := func(change *ConfigEvent) {
+		select {
+		case <-ctx.Done():
+		case configEvents <- change:
+		}
+	}
+	putTerminalError := func(change *ConfigEvent) {
+		go func() {
+			select {
+			case <-time.After(10 * time.Minute):
+			case configEvents <- change:
+			}
+		}()
+	}
+	go func() {
+		for {
+			select {
+			case change, open := <-changes:
+				if !open {
+					select {
+					case <-ctx.Done():
+					default:
+						putTerminalError(&ConfigEvent{name: name, err: ErrWatchClosedUnexpectedly})
+					}
+					return
+				}
+				if change.Error != nil {
+					putTerminalError(&ConfigEvent{name: name, err: watchError(change.Error)})
+					return
+				}
+				put(newConfigEvent(name, change.Value))
+			}
+		}
+	}()
+
+	return current, configEvents, nil
+}
+
+func newConfigEvent(name string, value *registry.Value) *ConfigEvent {
+	if value == nil {
+		return &ConfigEvent{name: name}
+	}
+	v, err := decodeConfig(value.Data)
+	return &ConfigEvent{
+		name:     name,
+		err:      err,
+		Value:    v,
+		Revision: value.Revision,
+	}
+}
+
+func (c *Client) encodeConfig(name string, v interface{}) (string, []byte, error) {
+	nsName, err := namespaceName(configs, c.cfg.Namespace, name)
+	if err != nil {
+		return "", nil, err
+	}
+	typeName, codecName, data, err := codec.MarshalCodec(v)
+	if err != nil {
+		return "", nil, err
+	}
+	value, err := json.Marshal(&configValue{
+		TypeName:  typeName,
+		CodecName: codecName,
+		Data:      data,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return nsName, value, nil
+}
+
+func decodeConfig(value []byte) (interface{}, error) {
+	cv := &configValue{}
+	err := json.Unmarshal(value, cv)
+	if err != nil {
+		return nil, err
+	}
+	return codec.UnmarshalCodec(cv.Data, cv.TypeName, cv.CodecName)
+}
@@ -0,0 +1,78 @@
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, _, err := client.GetConfig(ctx, "limits")
+	if err != ErrUnknownConfig {
+		t.Fatalf("expected error: %v, found: %v", ErrUnknownConfig, err)
+	}
+
+	current, watch, err := client.WatchConfig(ctx, "limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Value != nil {
+		t.Fatalf("expected no current value, found: %v", current.Value)
+	}
+
+	rev, err := client.CompareAndSwapConfig(ctx, "limits", &EchoMsg{Msg: "100"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.CompareAndSwapConfig(ctx, "limits", &EchoMsg{Msg: "200"}, 0)
+	if err != ErrConfigChanged {
+		t.Fatalf("expected error: %v, found: %v", ErrConfigChanged, err)
+	}
+
+	v, found, err := client.GetConfig(ctx, "limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != rev {
+		t.Fatalf("expected revision: %v, found: %v", rev, found)
+	}
+	if msg, ok := v.(*EchoMsg); !ok || msg.Msg != "100" {
+		t.Fatalf("expected config value: 100, found: %v", v)
+	}
+
+	select {
+	case event := <-watch:
+		if event.Err() != nil {
+			t.Fatal(event.Err())
+		}
+		if msg, ok := event.Value.(*EchoMsg); !ok || msg.Msg != "100" {
+			t.Fatalf("expected config value: 100, found: %v", event.Value)
+		}
+		if event.Revision != rev {
+			t.Fatalf("expected revision: %v, found: %v", rev, event.Revision)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	err = client.DeleteConfig(ctx, "limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-watch:
+		if event.Value != nil {
+			t.Fatalf("expected config deleted, found: %v", event.Value)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
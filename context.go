@@ -42,3 +42,23 @@ func ContextActorNamespace(c context.Context) (string, error) {
 	}
 	return cv.server.cfg.Namespace, nil
 }
+
+// ContextActorToken returns the fencing token of the actor's registration,
+// see registry.Registration.Token. Pass it to requests with WithFencingToken
+// so that receivers can reject requests from a stale owner of the name. The
+// error ErrOwnershipLost is returned once the actor no longer owns its name.
+func ContextActorToken(c context.Context) (int64, error) {
+	v := c.Value(contextKey)
+	if v == nil {
+		return 0, ErrInvalidContext
+	}
+	cv, ok := v.(*contextVal)
+	if !ok || cv.actorID == "" {
+		return 0, ErrInvalidContext
+	}
+	token, ok := cv.server.registry.Token(cv.actorID)
+	if !ok {
+		return 0, ErrOwnershipLost
+	}
+	return token, nil
+}
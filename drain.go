@@ -0,0 +1,201 @@
+package grid
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DrainingAnnotation of the registration of a peer which
+	// is draining. Schedulers should not place work on such
+	// peers, see QueryEvent.Draining.
+	DrainingAnnotation = "draining"
+
+	// defaultDrainTimeout when the context passed to Drain
+	// has no deadline.
+	defaultDrainTimeout = 60 * time.Second
+)
+
+// DrainReport of what failed while draining a server.
+type DrainReport struct {
+	// FailedHandoffs by actor name, of the actors whose
+	// handoff returned an error or did not finish in time.
+	FailedHandoffs map[string]error
+	// OpenMailboxes by name, of the mailboxes which had not
+	// closed by the deadline.
+	OpenMailboxes []string
+}
+
+// Drain the server and stop it. Draining proceeds in steps:
+//
+//     1. The peer's registration is updated with the draining
+//        status and annotation, and the peer refuses starts of
+//        actors and singletons.
+//     2. Running actors implementing HandoffActor are asked to
+//        hand their state to a successor on another peer, while
+//        requests to actors are still served.
+//     3. The peer refuses all requests, and those in flight are
+//        given time to finish. Clients retry refused requests,
+//        which follow the actors to their successors.
+//     4. The server is stopped, as with Stop.
+//
+// The context's deadline is the hard deadline of the drain, when
+// the context has none a default of 60 seconds is used. Steps 2
+// and 3 get three quarters of the time left, the rest is held back
+// for the mailboxes to close in step 4. Once the deadline passes,
+// the server is stopped without waiting for the remaining mailboxes
+// to close.
+// The report lists the actors which failed to hand off and the
+// mailboxes which failed to close, in which case the error
+// ErrIncompleteDrain is also returned.
+func (s *Server) Drain(c context.Context) (*DrainReport, error) {
+	if s.cancel == nil {
+		return nil, ErrServerNotRunning
+	}
+	if _, ok := c.Deadline(); !ok {
+		var cancel func()
+		c, cancel = context.WithTimeout(c, defaultDrainTimeout)
+		defer cancel()
+	}
+
+	s.mu.Lock()
+	s.draining = true
+	running := make(map[string]Actor, len(s.running))
+	for name, ra := range s.running {
+		running[name] = ra.actor
+	}
+	s.mu.Unlock()
+
+	// Mark the peer as draining, a failure to do so
+	// does not stop the drain.
+	nsName, err := namespaceName(Peers, s.cfg.Namespace, s.registry.Registry())
+	if err != nil {
+		return nil, err
+	}
+	timeout, cancel := context.WithTimeout(c, s.cfg.Timeout)
+	err = s.markDraining(timeout, nsName)
+	cancel()
+	if err != nil {
+		s.logf("%v: failed to mark peer as draining: %v", s.cfg.Namespace, err)
+	}
+
+	// Hold back part of the time left for the mailboxes
+	// to close, however long handoffs and requests take.
+	deadline, _ := c.Deadline()
+	stepsC, cancelSteps := context.WithDeadline(c, deadline.Add(-time.Until(deadline)/4))
+	defer cancelSteps()
+
+	report := &DrainReport{FailedHandoffs: s.handoff(stepsC, running)}
+
+	s.mu.Lock()
+	s.refusing = true
+	s.mu.Unlock()
+
+	// Give requests in flight time to finish.
+wait:
+	for atomic.LoadInt64(&s.inflight) > 0 {
+		select {
+		case <-stepsC.Done():
+			break wait
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	report.OpenMailboxes = s.shutdown(c)
+
+	if len(report.FailedHandoffs) > 0 || len(report.OpenMailboxes) > 0 {
+		return report, ErrIncompleteDrain
+	}
+	return report, nil
+}
+
+// handoff each of the actors implementing HandoffActor, concurrently,
+// and return the errors of those that failed or did not finish before
+// the context was done.
+func (s *Server) handoff(c context.Context, running map[string]Actor) map[string]error {
+	var mu sync.Mutex
+	pending := map[string]bool{}
+	failed := map[string]error{}
+
+	var wg sync.WaitGroup
+	for name, actor := range running {
+		h, ok := actor.(HandoffActor)
+		if !ok {
+			continue
+		}
+		pending[name] = true
+		wg.Add(1)
+		go func(name string, h HandoffActor) {
+			defer wg.Done()
+			err := h.Handoff(c)
+			mu.Lock()
+			defer mu.Unlock()
+			delete(pending, name)
+			if err != nil {
+				failed[name] = err
+			}
+		}(name, h)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-c.Done():
+	case <-done:
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for name := range pending {
+		failed[name] = c.Err()
+	}
+	for name, err := range failed {
+		s.logf("%v: actor: %v, failed to hand off: %v", s.cfg.Namespace, name, err)
+	}
+	result := make(map[string]error, len(failed))
+	for name, err := range failed {
+		result[name] = err
+	}
+	return result
+}
+
+// isDraining returns true once Drain has been called.
+func (s *Server) isDraining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+// isRefusing returns true once the handoffs of a drain are done,
+// and the server refuses all requests.
+func (s *Server) isRefusing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refusing
+}
+
+// markDraining updates the peer's registration with the draining
+// status, and annotation, keeping any other annotations it has.
+func (s *Server) markDraining(c context.Context, nsName string) error {
+	reg, err := s.registry.FindRegistration(c, nsName)
+	if err != nil {
+		return err
+	}
+	annotations := reg.Annotations
+	if !hasAnnotation(annotations, DrainingAnnotation) {
+		annotations = append(append([]string{}, annotations...), DrainingAnnotation)
+	}
+	return s.update(c, nsName, Update{Status: StatusDraining, Annotations: annotations})
+}
+
+// Draining is true if the entity's status is draining, or its
+// registration is annotated as draining, which only peers are,
+// see Server.Drain.
+func (e *QueryEvent) Draining() bool {
+	return e.status == StatusDraining || hasAnnotation(e.annotations, DrainingAnnotation)
+}
@@ -0,0 +1,274 @@
+package grid
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type handoffActor struct {
+	client   *Client
+	handoffs chan error
+}
+
+func (a *handoffActor) Act(c context.Context) {
+	<-c.Done()
+}
+
+// Handoff checks what other peers and clients see of
+// the draining peer, which is what a successor would
+// see while the state is handed to it.
+func (a *handoffActor) Handoff(c context.Context) error {
+	check := func() error {
+		peers, err := a.client.QueryC(c, Peers)
+		if err != nil {
+			return err
+		}
+		if len(peers) != 1 || !peers[0].Draining() {
+			return errors.New("expected peer to be draining")
+		}
+		_, err = a.client.RequestC(c, peers[0].Name(), NewActorStart("late"))
+		if err == nil || !strings.Contains(err.Error(), ErrServerDraining.Error()) {
+			return errors.New("expected actor start to be refused")
+		}
+		return nil
+	}
+	a.handoffs <- check()
+	return nil
+}
+
+func TestServerDrain(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer client.Close()
+
+	a := &handoffActor{client: client, handoffs: make(chan error, 1)}
+	server.RegisterDef("handoff", func(_ []byte) (Actor, error) { return a, nil })
+	server.RegisterDef("late", func(_ []byte) (Actor, error) { return &leaderActor{}, nil })
+
+	peers, err := client.Query(timeout, Peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 {
+		t.Fatal("expected 1 peer")
+	}
+	if peers[0].Draining() {
+		t.Fatal("expected peer not to be draining")
+	}
+	_, err = client.Request(timeout, peers[0].Name(), NewActorStart("handoff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A mailbox which is never closed.
+	_, err = NewMailbox(server, "stuck", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+	report, err := server.Drain(ctx)
+	if err != ErrIncompleteDrain {
+		t.Fatalf("expected error: %v, found: %v", ErrIncompleteDrain, err)
+	}
+	select {
+	case err := <-a.handoffs:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatal("expected actor to hand off")
+	}
+	if len(report.FailedHandoffs) != 0 {
+		t.Fatalf("expected no failed handoffs, found: %v", report.FailedHandoffs)
+	}
+	if len(report.OpenMailboxes) != 1 || report.OpenMailboxes[0] != "stuck" {
+		t.Fatalf("expected open mailbox: stuck, found: %v", report.OpenMailboxes)
+	}
+}
+
+func TestServerDrainUnderLoad(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer client.Close()
+	client.cs = newClientStats()
+
+	// A mailbox which responds until the server stops.
+	mailbox, err := NewMailbox(server, "busy", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer mailbox.Close()
+		for {
+			select {
+			case <-server.Context().Done():
+				return
+			case req, ok := <-mailbox.C:
+				if !ok {
+					return
+				}
+				req.Respond(req.Msg())
+			}
+		}
+	}()
+
+	// Keep sending requests until the server stops, the
+	// client retries those which are refused.
+	done := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			client.Request(timeout, "busy", &EchoMsg{Msg: "load"})
+		}
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	report, err := server.Drain(ctx)
+	if err != nil {
+		t.Fatalf("expected drain to complete, found error: %v, report: %v", err, report)
+	}
+	if len(report.OpenMailboxes) != 0 {
+		t.Fatalf("expected no open mailboxes, found: %v", report.OpenMailboxes)
+	}
+	close(done)
+	<-stopped
+	if v := client.cs.counters[numErrServerDraining]; v == 0 {
+		t.Fatal("expected requests to be refused while draining")
+	}
+}
+
+func TestClientRetriesDuringDrain(t *testing.T) {
+	const timeout = 5 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer client.Close()
+	client.cs = newClientStats()
+
+	successor, err := NewServer(etcd, ServerCfg{Namespace: server.cfg.Namespace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer successor.Stop()
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go successor.Serve(lis)
+	time.Sleep(2 * time.Second)
+
+	// serve the mailbox named moving with the given reply, until
+	// the server stops. A request for a slow reply is held until
+	// it is released, which keeps it in flight while draining.
+	received := make(chan bool)
+	release := make(chan bool)
+	serve := func(s *Server, mailbox *Mailbox, reply string) {
+		defer mailbox.Close()
+		for {
+			select {
+			case <-s.Context().Done():
+				return
+			case req, ok := <-mailbox.C:
+				if !ok {
+					return
+				}
+				if msg, ok := req.Msg().(*EchoMsg); ok && msg.Msg == "slow" {
+					close(received)
+					<-release
+				}
+				req.Respond(&EchoMsg{Msg: reply})
+			}
+		}
+	}
+	mailbox, err := NewMailbox(server, "moving", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serve(server, mailbox, "old")
+
+	// Once the draining server stops, the mailbox
+	// moves to the successor.
+	go func() {
+		<-server.Context().Done()
+		t0 := time.Now()
+		for time.Since(t0) < timeout {
+			mailbox, err := NewMailbox(successor, "moving", 10)
+			if err == nil {
+				serve(successor, mailbox, "new")
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	_, err = client.Request(timeout, "moving", &EchoMsg{Msg: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Request(timeout, "moving", &EchoMsg{Msg: "slow"})
+	<-received
+
+	drained := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, err := server.Drain(ctx)
+		drained <- err
+	}()
+	for !server.isRefusing() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The request is refused by the draining server, then
+	// retried, and answered by the mailbox's successor.
+	replies := make(chan interface{}, 1)
+	errs := make(chan error, 1)
+	go func() {
+		res, err := client.Request(timeout, "moving", &EchoMsg{Msg: "moved"})
+		if err != nil {
+			errs <- err
+			return
+		}
+		replies <- res
+	}()
+	for {
+		client.cs.mu.Lock()
+		refused := client.cs.counters[numErrServerDraining]
+		client.cs.mu.Unlock()
+		if refused > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+
+	select {
+	case err := <-errs:
+		t.Fatal(err)
+	case res := <-replies:
+		if msg, ok := res.(*EchoMsg); !ok || msg.Msg != "new" {
+			t.Fatalf("expected reply from successor, found: %v", res)
+		}
+	}
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -17,6 +17,8 @@ var (
 	// ErrInvalidMailboxName when a mailbox name contains invalid
 	// character codes.
 	ErrInvalidMailboxName = errors.New("grid: invalid mailbox name")
+	// ErrInvalidNamePattern when a query's name glob is malformed.
+	ErrInvalidNamePattern = errors.New("grid: invalid name pattern")
 )
 
 var (
@@ -36,6 +38,16 @@ var (
 	// ErrIncompleteBroadcast when the Broadcast cannot successfully request
 	// an actor in the Group
 	ErrIncompleteBroadcast = errors.New("grid: incomplete broadcast")
+	// ErrUnsupportedCompression when a delivery is compressed
+	// with an algorithm this peer cannot decompress.
+	ErrUnsupportedCompression = errors.New("grid: unsupported compression")
+	// ErrMessageTooLarge when a delivery decompresses to more
+	// than the maximum message size.
+	ErrMessageTooLarge = errors.New("grid: message too large")
+	// ErrUndecodableMessage when the peer of the receiver has not
+	// registered the type of the message being sent, and so cannot
+	// decode it.
+	ErrUndecodableMessage = errors.New("grid: receiver cannot decode message type")
 )
 
 var (
@@ -53,10 +65,50 @@ var (
 	// ErrServerNotRunning when an operation which requires the
 	// server be running, but is not, is requested.
 	ErrServerNotRunning = errors.New("grid: server not running")
+	// ErrServerDraining when a request, such as an actor start,
+	// is sent to a peer which is draining. The receiver did not
+	// get the request, so clients retry it.
+	ErrServerDraining = errors.New("grid: server draining")
+	// ErrIncompleteDrain when a drain finishes with actors that
+	// failed to hand off, or mailboxes that failed to close.
+	ErrIncompleteDrain = errors.New("grid: incomplete drain")
 	// ErrAlreadyRegistered when a mailbox is created but someone
 	// else has already created it.
 	ErrAlreadyRegistered = errors.New("grid: already registered")
+	// ErrOwnershipLost when the fencing token of an actor or
+	// mailbox is requested, but the registration of its name
+	// is no longer owned by its server.
+	ErrOwnershipLost = errors.New("grid: ownership lost")
 	// ErrWatchClosedUnexpectedly when a query watch closes before
 	// it was requested to close, likely do to some etcd issue.
 	ErrWatchClosedUnexpectedly = errors.New("grid: watch closed unexpectedly")
+	// ErrSlowWatcher when a watch is disconnected because its
+	// buffer is full, see ClientCfg.SlowWatcherPolicy.
+	ErrSlowWatcher = errors.New("grid: slow watcher")
+	// ErrNoLeader when no peer in the namespace is running
+	// the leader actor.
+	ErrNoLeader = errors.New("grid: no leader")
+	// ErrDuplicateSingleton when a singleton is registered
+	// under a name already used by another singleton.
+	ErrDuplicateSingleton = errors.New("grid: duplicate singleton")
+	// ErrLocked when trying to lock a lock which is held.
+	ErrLocked = errors.New("grid: locked")
+	// ErrNoPermits when trying to acquire a permit of a
+	// semaphore whose permits are all held.
+	ErrNoPermits = errors.New("grid: no permits available")
+	// ErrInvalidPermits when a semaphore is created with
+	// fewer than one permit.
+	ErrInvalidPermits = errors.New("grid: invalid number of permits")
+	// ErrInvalidTTL when a lock or semaphore is used with
+	// a TTL shorter than one second.
+	ErrInvalidTTL = errors.New("grid: invalid ttl")
+	// ErrUnknownConfig when a config which has no value
+	// is requested.
+	ErrUnknownConfig = errors.New("grid: unknown config")
+	// ErrConfigChanged when a config is compared and swapped,
+	// but has changed since the revision given.
+	ErrConfigChanged = errors.New("grid: config changed")
+	// ErrInvalidRootPrefix when a root prefix is not of the
+	// form "/name", or "/name/name" and so on.
+	ErrInvalidRootPrefix = errors.New("grid: invalid root prefix")
 )
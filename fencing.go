@@ -0,0 +1,61 @@
+package grid
+
+import "context"
+
+// fencingTokenKey of the fencing token to send with requests.
+type fencingTokenKey struct{}
+
+// receivedFencingTokenKey of the fencing token received with
+// a request, kept apart from fencingTokenKey so that requests
+// made with the request's context do not forward it.
+type receivedFencingTokenKey struct{}
+
+// WithFencingToken returns a context carrying the fencing token.
+// Requests made with the context deliver the token along with
+// the message, and the receiver finds it with ReceivedFencingToken
+// on the request's context. For example an actor can fence its
+// requests with the token of its own registration:
+//
+//     token, err := grid.ContextActorToken(ctx)
+//     ...
+//     res, err := client.RequestC(grid.WithFencingToken(ctx, token), "store", msg)
+//
+// Tokens are revisions of etcd, so a registration made later
+// has a larger token, whoever made it. The receiver can reject
+// requests with a token smaller than the largest it has seen for
+// the resource it guards. The sender is not identified by the
+// request, so senders which must be told apart should include
+// their name in the message.
+func WithFencingToken(c context.Context, token int64) context.Context {
+	return context.WithValue(c, fencingTokenKey{}, token)
+}
+
+// FencingToken the context carries for outgoing requests, see
+// WithFencingToken, false is returned if the context carries none.
+func FencingToken(c context.Context) (int64, bool) {
+	token, ok := c.Value(fencingTokenKey{}).(int64)
+	if !ok || token == 0 {
+		return 0, false
+	}
+	return token, true
+}
+
+// ReceivedFencingToken the sender delivered with a request, false is
+// returned if it delivered none. Use the context of the request:
+//
+//     token, ok := grid.ReceivedFencingToken(req.Context())
+//
+// The token is not forwarded by requests made with the context.
+func ReceivedFencingToken(c context.Context) (int64, bool) {
+	token, ok := c.Value(receivedFencingTokenKey{}).(int64)
+	if !ok || token == 0 {
+		return 0, false
+	}
+	return token, true
+}
+
+// withReceivedFencingToken returns a context carrying the
+// fencing token received with a request.
+func withReceivedFencingToken(c context.Context, token int64) context.Context {
+	return context.WithValue(c, receivedFencingTokenKey{}, token)
+}
@@ -0,0 +1,79 @@
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFencingToken(t *testing.T) {
+	if _, ok := FencingToken(context.Background()); ok {
+		t.Fatal("expected no fencing token")
+	}
+	token, ok := FencingToken(WithFencingToken(context.Background(), 42))
+	if !ok || token != 42 {
+		t.Fatalf("expected fencing token: 42, found: %v", token)
+	}
+	if _, ok := ReceivedFencingToken(WithFencingToken(context.Background(), 42)); ok {
+		t.Fatal("expected no received fencing token")
+	}
+}
+
+func TestRequestWithFencingToken(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	mailbox, err := NewMailbox(server, "fenced", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mailbox.Close()
+
+	token, err := mailbox.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token <= 0 {
+		t.Fatalf("expected positive fencing token, found: %v", token)
+	}
+
+	received := make(chan int64, 1)
+	go func() {
+		req := <-mailbox.C
+		token, _ := ReceivedFencingToken(req.Context())
+		// The token is not forwarded downstream.
+		if _, ok := FencingToken(req.Context()); ok {
+			token = -1
+		}
+		received <- token
+		req.Ack()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err = client.RequestC(WithFencingToken(ctx, token), "fenced", &EchoMsg{"fenced"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := <-received; found != token {
+		t.Fatalf("expected fencing token: %v, found: %v", token, found)
+	}
+
+	// A mailbox registered later has a larger token.
+	later, err := NewMailbox(server, "fenced-later", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer later.Close()
+	laterToken, err := later.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if laterToken <= token {
+		t.Fatalf("expected fencing token larger than: %v, found: %v", token, laterToken)
+	}
+}
@@ -0,0 +1,142 @@
+package grid
+
+import (
+	"path"
+	"strings"
+)
+
+// Query of entities in a namespace, narrowed by name, hosting
+// peer, and annotations. Each condition added to the query must
+// hold for an entity to match.
+//
+// Example usage:
+//
+//     q := grid.NewQuery(grid.Mailboxes).
+//         NamePrefix("worker-").
+//         Annotation("role", "ingest").
+//         AnnotationExists("shard")
+//
+//     mailboxes, err := client.QueryBy(timeout, q)
+//
+type Query struct {
+	entity      EntityType
+	prefix      string
+	globs       []string
+	peers       map[string]bool
+	statuses    map[string]bool
+	annotations []annotationPredicate
+}
+
+// annotationPredicate holds for an entity with an annotation
+// of the form "key=value", or just with an annotation named
+// key, or of the form "key=..." when exists is true.
+type annotationPredicate struct {
+	key    string
+	value  string
+	exists bool
+}
+
+// NewQuery of the given entity type, which matches every
+// entity of that type until conditions are added.
+func NewQuery(entity EntityType) *Query {
+	return &Query{entity: entity}
+}
+
+// NamePrefix of matching entities. The prefix also narrows
+// the scan of the registry, making it the cheapest condition.
+func (q *Query) NamePrefix(prefix string) *Query {
+	q.prefix = prefix
+	return q
+}
+
+// NameGlob, in the syntax of path.Match, of matching entities,
+// for example "worker-*-group-?".
+func (q *Query) NameGlob(pattern string) *Query {
+	q.globs = append(q.globs, pattern)
+	return q
+}
+
+// Peer hosting matching entities. Calling Peer more than once
+// matches entities on any of the given peers.
+func (q *Query) Peer(peer string) *Query {
+	if q.peers == nil {
+		q.peers = make(map[string]bool)
+	}
+	q.peers[peer] = true
+	return q
+}
+
+// Status of matching entities, see Update. Calling Status more
+// than once matches entities with any of the given statuses.
+func (q *Query) Status(status string) *Query {
+	if q.statuses == nil {
+		q.statuses = make(map[string]bool)
+	}
+	q.statuses[status] = true
+	return q
+}
+
+// Annotation "key=value" of matching entities.
+func (q *Query) Annotation(key, value string) *Query {
+	q.annotations = append(q.annotations, annotationPredicate{key: key, value: value})
+	return q
+}
+
+// AnnotationExists for key on matching entities, either as the
+// bare annotation "key", or with any value as in "key=value".
+func (q *Query) AnnotationExists(key string) *Query {
+	q.annotations = append(q.annotations, annotationPredicate{key: key, exists: true})
+	return q
+}
+
+// validate the query's patterns.
+func (q *Query) validate() error {
+	for _, g := range q.globs {
+		if _, err := path.Match(g, ""); err != nil {
+			return ErrInvalidNamePattern
+		}
+	}
+	return nil
+}
+
+// matches returns true if the event's entity meets every
+// condition of the query.
+func (q *Query) matches(e *QueryEvent) bool {
+	if !strings.HasPrefix(e.name, q.prefix) {
+		return false
+	}
+	for _, g := range q.globs {
+		if ok, _ := path.Match(g, e.name); !ok {
+			return false
+		}
+	}
+	if q.peers != nil && !q.peers[e.peer] {
+		return false
+	}
+	if q.statuses != nil && !q.statuses[e.Status()] {
+		return false
+	}
+	for _, p := range q.annotations {
+		if !p.holds(e.annotations) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p annotationPredicate) holds(annotations []string) bool {
+	for _, a := range annotations {
+		key, value := a, ""
+		hasValue := false
+		if i := strings.Index(a, "="); i >= 0 {
+			key, value, hasValue = a[:i], a[i+1:], true
+		}
+		if key != p.key {
+			continue
+		}
+		if p.exists || (hasValue && value == p.value) {
+			return true
+		}
+	}
+	return false
+}
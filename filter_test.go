@@ -0,0 +1,49 @@
+package grid
+
+import "testing"
+
+func TestQueryMatches(t *testing.T) {
+	e := &QueryEvent{
+		name:        "worker-1-group-2",
+		peer:        "peer-a",
+		entity:      Mailboxes,
+		annotations: []string{"role=ingest", "shard"},
+		Type:        EntityFound,
+	}
+
+	cases := []struct {
+		q        *Query
+		expected bool
+	}{
+		{NewQuery(Mailboxes), true},
+		{NewQuery(Mailboxes).NamePrefix("worker-"), true},
+		{NewQuery(Mailboxes).NamePrefix("leader"), false},
+		{NewQuery(Mailboxes).NameGlob("worker-*-group-?"), true},
+		{NewQuery(Mailboxes).NameGlob("worker-*-group-??"), false},
+		{NewQuery(Mailboxes).Peer("peer-a"), true},
+		{NewQuery(Mailboxes).Peer("peer-b"), false},
+		{NewQuery(Mailboxes).Peer("peer-b").Peer("peer-a"), true},
+		{NewQuery(Mailboxes).Annotation("role", "ingest"), true},
+		{NewQuery(Mailboxes).Annotation("role", "egress"), false},
+		{NewQuery(Mailboxes).AnnotationExists("role"), true},
+		{NewQuery(Mailboxes).AnnotationExists("shard"), true},
+		{NewQuery(Mailboxes).AnnotationExists("version"), false},
+		{NewQuery(Mailboxes).Annotation("shard", ""), false},
+		{NewQuery(Mailboxes).NamePrefix("worker-").Annotation("role", "ingest").Peer("peer-b"), false},
+		{NewQuery(Mailboxes).Status(StatusReady), true},
+		{NewQuery(Mailboxes).Status(StatusDegraded), false},
+		{NewQuery(Mailboxes).Status(StatusDegraded).Status(StatusReady), true},
+	}
+	for i, c := range cases {
+		if c.q.matches(e) != c.expected {
+			t.Fatalf("case %v: expected match: %v", i, c.expected)
+		}
+	}
+}
+
+func TestQueryInvalidGlob(t *testing.T) {
+	err := NewQuery(Actors).NameGlob("worker-[").validate()
+	if err != ErrInvalidNamePattern {
+		t.Fatal("expected invalid name pattern error")
+	}
+}
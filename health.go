@@ -0,0 +1,199 @@
+package grid
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// monitorConnections of the client every health check interval,
+// until the context is done.
+func (c *Client) monitorConnections(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkConnections(ctx)
+		}
+	}
+}
+
+// checkConnections closes the pools of peers which have left
+// the namespace, and redials unhealthy connections of the rest.
+func (c *Client) checkConnections(ctx context.Context) {
+	// Snapshot the pools and their connections, since
+	// the connections are replaced while checking.
+	c.mu.Lock()
+	pools := make(map[string]*clientAndConnPool, len(c.clientsAndConns))
+	conns := make(map[string][]*clientAndConn, len(c.clientsAndConns))
+	for address, ccpool := range c.clientsAndConns {
+		pools[address] = ccpool
+		conns[address] = append([]*clientAndConn(nil), ccpool.clientConns...)
+	}
+	c.mu.Unlock()
+
+	if len(pools) == 0 {
+		return
+	}
+
+	live, err := c.peerAddresses(ctx)
+	if err != nil {
+		c.logf("failed checking connections, error: %v", err)
+		return
+	}
+
+	for address, ccpool := range pools {
+		if !live[address] {
+			c.closePool(address, ccpool)
+			continue
+		}
+		for i, cc := range conns[address] {
+			if c.healthy(ctx, cc) {
+				continue
+			}
+			c.redial(address, ccpool, i, cc)
+		}
+	}
+}
+
+// peerAddresses of the peers currently in the namespace.
+func (c *Client) peerAddresses(ctx context.Context) (map[string]bool, error) {
+	nsPrefix, err := namespacePrefix(Peers, c.cfg.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	timeout, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	regs, err := c.registry.FindRegistrations(timeout, nsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	live := make(map[string]bool, len(regs))
+	for _, reg := range regs {
+		live[reg.Address] = true
+	}
+	return live, nil
+}
+
+// healthy connection, one that has not failed or shut down, and
+// which answers a health ping. Peers which do not serve the gRPC
+// health service still answer, with codes.Unimplemented.
+func (c *Client) healthy(ctx context.Context, cc *clientAndConn) bool {
+	switch cc.conn.GetState() {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return false
+	}
+	timeout, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	_, err := healthpb.NewHealthClient(cc.conn).Check(timeout, &healthpb.HealthCheckRequest{})
+	return err == nil || status.Code(err) == codes.Unimplemented
+}
+
+// closePool of the address, if it is still the client's pool
+// for the address, and forget everything cached about it.
+func (c *Client) closePool(address string, ccpool *clientAndConnPool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if current, ok := c.clientsAndConns[address]; !ok || current.id != ccpool.id {
+		return
+	}
+
+	// Test hook.
+	c.cs.Inc(numHealthCheckClosePool)
+
+	// Schemas are cached by peer name, so collect the
+	// peers of the receivers at the address as they
+	// are forgotten.
+	for nsReceiver, a := range c.addresses {
+		if a != address {
+			continue
+		}
+		peer := c.forgetReceiver(nsReceiver)
+		delete(c.schemas, peer)
+	}
+	c.forgetPool(address, ccpool)
+}
+
+// redial the i-th connection of the pool, replacing cc, if the
+// pool is still the client's pool for the address.
+func (c *Client) redial(address string, ccpool *clientAndConnPool, i int, cc *clientAndConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if current, ok := c.clientsAndConns[address]; !ok || current.id != ccpool.id || ccpool.clientConns[i] != cc {
+		return
+	}
+
+	// Test hook.
+	c.cs.Inc(numHealthCheckRedial)
+
+	replacement, err := c.dial(address)
+	if err != nil {
+		c.logf("failed redialing: %v, error: %v", address, err)
+		return
+	}
+	ccpool.clientConns[i] = replacement
+	err = cc.close()
+	if err != nil {
+		c.logf("failed closing connection to: %v, error: %v", address, err)
+	}
+}
+
+const (
+	// healthInterval between updates of the server's
+	// health status.
+	healthInterval = 1 * time.Second
+)
+
+// monitorHealth of the server, reporting it through the standard
+// gRPC health service. The server is serving while its registry
+// lease is kept alive, and not serving once the lease is at risk
+// of expiring, or the server is stopping.
+func (s *Server) monitorHealth() {
+	s.setServingStatus(s.servingStatus())
+	go func() {
+		ticker := time.NewTicker(healthInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				s.setServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+				return
+			case <-ticker.C:
+				s.setServingStatus(s.servingStatus())
+			}
+		}
+	}()
+}
+
+// servingStatus of the server. The etcd client keeps the lease
+// alive every third of its duration, so a lease which has not
+// been kept alive for half its duration has missed at least one
+// keep alive and is at risk of expiring.
+func (s *Server) servingStatus() healthpb.HealthCheckResponse_ServingStatus {
+	select {
+	case <-s.ctx.Done():
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	default:
+	}
+	if s.registry.KeepAliveAge() > s.cfg.LeaseDuration/2 {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+// setServingStatus of the server as a whole, and of the wire
+// service, which are the same.
+func (s *Server) setServingStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	s.health.SetServingStatus("", status)
+	s.health.SetServingStatus("grid.wire", status)
+}
@@ -0,0 +1,147 @@
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestClientClosesPoolsOfDepartedPeers(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer client.Close()
+
+	monitored, err := NewClient(etcd, ClientCfg{
+		Namespace:           server.cfg.Namespace,
+		HealthCheckInterval: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer monitored.Close()
+
+	poolCount := func() int {
+		monitored.mu.Lock()
+		defer monitored.mu.Unlock()
+		return len(monitored.clientsAndConns)
+	}
+
+	// Request the peer's own mailbox, which opens a pool
+	// of connections to the peer, the start itself fails.
+	peers, err := monitored.Query(timeout, Peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 {
+		t.Fatal("expected 1 peer")
+	}
+	_, err = monitored.Request(timeout, peers[0].Name(), NewActorStart("undefined"))
+	if err == nil {
+		t.Fatal("expected error starting undefined actor")
+	}
+	if poolCount() != 1 {
+		t.Fatalf("expected 1 connection pool, found: %v", poolCount())
+	}
+
+	// Once the peer leaves the namespace its
+	// pool is closed in the background.
+	server.Stop()
+	t0 := time.Now()
+	for poolCount() != 0 {
+		if time.Since(t0) > 10*time.Second {
+			t.Fatal("expected connection pool to be closed")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestClientClosePoolForgetsPeer(t *testing.T) {
+	const address = "localhost:7777"
+
+	ccpool := &clientAndConnPool{id: 1}
+	client := &Client{
+		addresses: map[string]string{
+			"ns.mailbox.a": address,
+			"ns.mailbox.b": address,
+			"ns.mailbox.c": "localhost:8888",
+		},
+		peers: map[string]string{
+			"ns.mailbox.a": "peer-1",
+			"ns.mailbox.b": "peer-1",
+			"ns.mailbox.c": "peer-2",
+		},
+		clientsAndConns: map[string]*clientAndConnPool{address: ccpool},
+		schemas: map[string]*peerSchemas{
+			"peer-1": {revision: 1, schemas: map[string]string{"msg": "0"}},
+			"peer-2": {revision: 1, schemas: map[string]string{"msg": "0"}},
+		},
+		accepted: map[string][]Delivery_Compression{
+			address: supportedCompression,
+		},
+	}
+
+	// The peer has left, so the health check closes its pool.
+	client.closePool(address, ccpool)
+
+	if len(client.clientsAndConns) != 0 {
+		t.Fatalf("expected no connection pools, found: %v", client.clientsAndConns)
+	}
+	if len(client.accepted) != 0 {
+		t.Fatalf("expected no accepted compression, found: %v", client.accepted)
+	}
+	if _, ok := client.schemas["peer-1"]; ok {
+		t.Fatal("expected schemas of departed peer to be forgotten")
+	}
+	if _, ok := client.schemas["peer-2"]; !ok {
+		t.Fatal("expected schemas of other peer to be kept")
+	}
+	for _, nsReceiver := range []string{"ns.mailbox.a", "ns.mailbox.b"} {
+		if _, ok := client.addresses[nsReceiver]; ok {
+			t.Fatalf("expected address of: %v, to be forgotten", nsReceiver)
+		}
+		if _, ok := client.peers[nsReceiver]; ok {
+			t.Fatalf("expected peer of: %v, to be forgotten", nsReceiver)
+		}
+	}
+	if client.addresses["ns.mailbox.c"] != "localhost:8888" || client.peers["ns.mailbox.c"] != "peer-2" {
+		t.Fatal("expected receiver of other peer to be kept")
+	}
+}
+
+func TestServerHealth(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer client.Close()
+
+	conn, err := grpc.Dial(server.registry.Address(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "grid.wire"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected serving, got: %v", res.GetStatus())
+	}
+
+	server.Stop()
+	res, err = server.health.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("expected not serving, got: %v", res.GetStatus())
+	}
+}
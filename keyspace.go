@@ -0,0 +1,114 @@
+package grid
+
+import (
+	"context"
+	"regexp"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+	"github.com/lytics/grid/registry"
+)
+
+// KeyLayoutVersion of the keys grid stores in etcd under a root prefix.
+//
+// With an empty root prefix, the default, grid keeps the original flat
+// layout, with every key at the root of the etcd keyspace:
+//
+//     <namespace>.<entity>.<name>
+//
+// With a root prefix, for example "/acme/grid", every key is stored
+// under the root prefix and the layout version:
+//
+//     <root prefix>/v1/<namespace>.<entity>.<name>
+//
+// where entity is one of "peer", "actor", "mailbox", "lock",
+// "semaphore", or "config". Peers, actors, mailboxes, and the holders
+// of locks and semaphores are bound to leases, configs are not. Since
+// nothing is stored outside the root prefix, etcd's role based access
+// control can grant a role read and write access to just the prefix.
+// A future layout would be stored under "<root prefix>/v2/", next to
+// the current one, so both can be used during a migration.
+const KeyLayoutVersion = "v1"
+
+// keyspace in etcd of the given root prefix, the empty
+// string for the flat layout of an empty root prefix.
+func keyspace(rootPrefix string) (string, error) {
+	if rootPrefix == "" {
+		return "", nil
+	}
+	if !isRootPrefixValid(rootPrefix) {
+		return "", ErrInvalidRootPrefix
+	}
+	return rootPrefix + "/" + KeyLayoutVersion + "/", nil
+}
+
+// isRootPrefixValid returns true if the root prefix matches
+// the regular expression "^(/[a-zA-Z0-9-_]+)+$".
+func isRootPrefixValid(rootPrefix string) bool {
+	const validRootPrefix = "^(/[a-zA-Z0-9-_]+)+$"
+
+	matched, err := regexp.MatchString(validRootPrefix, rootPrefix)
+	return err == nil && matched
+}
+
+// MigrationCfg of a migration of a namespace's keys from one root
+// prefix to another, see Migrate.
+type MigrationCfg struct {
+	// Namespace whose keys are migrated.
+	Namespace string
+	// FromRootPrefix and ToRootPrefix, either of which can be
+	// empty for the flat layout.
+	FromRootPrefix string
+	ToRootPrefix   string
+	// Remove the keys from the old root prefix once moved.
+	Remove bool
+	// DryRun only reports which keys would be moved.
+	DryRun bool
+}
+
+// Migration report, see Migrate.
+type Migration struct {
+	// Moved keys, in the form "<namespace>.<entity>.<name>".
+	Moved []string
+	// Skipped keys, which already existed under the new root
+	// prefix, or changed while being moved.
+	Skipped []string
+}
+
+// Migrate the keys of a namespace from one root prefix to another,
+// for example from the flat layout to a root prefix. Configs are
+// moved as they are. Registrations keep their lease, so they still
+// expire with the peer which registered them, which keeps using the
+// old root prefix until it is restarted with the new one.
+//
+// Example usage:
+//
+//     m, err := grid.Migrate(ctx, etcd, grid.MigrationCfg{
+//         Namespace:    "acme",
+//         ToRootPrefix: "/acme/grid",
+//     })
+//
+// See also the command grid-migrate.
+func Migrate(c context.Context, etcd *etcdv3.Client, cfg MigrationCfg) (*Migration, error) {
+	if etcd == nil {
+		return nil, ErrNilEtcd
+	}
+	if !isNameValid(cfg.Namespace) {
+		return nil, ErrInvalidNamespace
+	}
+	from, err := keyspace(cfg.FromRootPrefix)
+	if err != nil {
+		return nil, err
+	}
+	to, err := keyspace(cfg.ToRootPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if from == to {
+		return &Migration{}, nil
+	}
+	m, err := registry.Migrate(c, etcd, from, to, cfg.Namespace+".", cfg.Remove, cfg.DryRun)
+	if m == nil {
+		return nil, err
+	}
+	return &Migration{Moved: m.Moved, Skipped: m.Skipped}, err
+}
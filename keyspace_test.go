@@ -0,0 +1,173 @@
+package grid
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/lytics/grid/testetcd"
+)
+
+func TestKeyspace(t *testing.T) {
+	cases := []struct {
+		root     string
+		expected string
+		err      error
+	}{
+		{"", "", nil},
+		{"/acme", "/acme/v1/", nil},
+		{"/acme/grid", "/acme/grid/v1/", nil},
+		{"acme", "", ErrInvalidRootPrefix},
+		{"/acme/", "", ErrInvalidRootPrefix},
+		{"/acme//grid", "", ErrInvalidRootPrefix},
+		{"/acme.grid", "", ErrInvalidRootPrefix},
+	}
+	for _, c := range cases {
+		ks, err := keyspace(c.root)
+		if err != c.err {
+			t.Fatalf("root prefix: %q, expected error: %v, found: %v", c.root, c.err, err)
+		}
+		if ks != c.expected {
+			t.Fatalf("root prefix: %q, expected keyspace: %q, found: %q", c.root, c.expected, ks)
+		}
+	}
+}
+
+func TestNewServerInvalidRootPrefix(t *testing.T) {
+	_, err := NewServer(nil, ServerCfg{Namespace: "ns", RootPrefix: "acme"})
+	if err != ErrInvalidRootPrefix {
+		t.Fatalf("expected error: %v, found: %v", ErrInvalidRootPrefix, err)
+	}
+	_, err = NewClient(nil, ClientCfg{Namespace: "ns", RootPrefix: "acme"})
+	if err != ErrInvalidRootPrefix {
+		t.Fatalf("expected error: %v, found: %v", ErrInvalidRootPrefix, err)
+	}
+}
+
+func TestRootPrefix(t *testing.T) {
+	const root = "/test/grid"
+
+	namespace := newNamespace()
+	etcd := testetcd.StartAndConnect(t)
+	defer etcd.Close()
+
+	server, err := NewServer(etcd, ServerCfg{Namespace: namespace, RootPrefix: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+	defer server.Stop()
+	time.Sleep(2 * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The peer is stored under the root prefix, and nowhere else.
+	res, err := etcd.Get(ctx, root+"/"+KeyLayoutVersion+"/"+namespace+".peer.", clientv3.WithPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Count != 1 {
+		t.Fatalf("expected 1 peer under the root prefix, found: %v", res.Count)
+	}
+	res, err = etcd.Get(ctx, namespace+".", clientv3.WithPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Count != 0 {
+		t.Fatalf("expected no keys in the flat layout, found: %v", res.Count)
+	}
+
+	// Only clients using the same root prefix find the peer.
+	client, err := NewClient(etcd, ClientCfg{Namespace: namespace, RootPrefix: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	peers, err := client.QueryC(ctx, Peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 {
+		t.Fatalf("expected 1 peer, found: %v", len(peers))
+	}
+
+	flat, err := NewClient(etcd, ClientCfg{Namespace: namespace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer flat.Close()
+	peers, err = flat.QueryC(ctx, Peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 0 {
+		t.Fatalf("expected no peers, found: %v", len(peers))
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	const root = "/test/grid"
+
+	namespace := newNamespace()
+	etcd := testetcd.StartAndConnect(t)
+	defer etcd.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	flat, err := NewClient(etcd, ClientCfg{Namespace: namespace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer flat.Close()
+	_, err = flat.PutConfig(ctx, "limits", &EchoMsg{Msg: "100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := MigrationCfg{Namespace: namespace, ToRootPrefix: root, Remove: true}
+
+	cfg.DryRun = true
+	m, err := Migrate(ctx, etcd, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Moved) != 1 || m.Moved[0] != namespace+".config.limits" {
+		t.Fatalf("expected config to be moved, found: %v", m.Moved)
+	}
+	if _, _, err := flat.GetConfig(ctx, "limits"); err != nil {
+		t.Fatalf("expected config unchanged by dry run, found error: %v", err)
+	}
+
+	cfg.DryRun = false
+	m, err = Migrate(ctx, etcd, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Moved) != 1 || len(m.Skipped) != 0 {
+		t.Fatalf("expected 1 key moved, found: %v", m)
+	}
+
+	prefixed, err := NewClient(etcd, ClientCfg{Namespace: namespace, RootPrefix: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prefixed.Close()
+	v, _, err := prefixed.GetConfig(ctx, "limits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, ok := v.(*EchoMsg); !ok || msg.Msg != "100" {
+		t.Fatalf("expected migrated config, found: %v", v)
+	}
+	if _, _, err := flat.GetConfig(ctx, "limits"); err != ErrUnknownConfig {
+		t.Fatalf("expected error: %v, found: %v", ErrUnknownConfig, err)
+	}
+}
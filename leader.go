@@ -0,0 +1,199 @@
+package grid
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lytics/grid/registry"
+)
+
+const (
+	// leaderName of the leader actor, and its actor type.
+	leaderName = "leader"
+)
+
+// Leader of a namespace, the peer running the actor
+// named "leader", and the time it was started.
+type Leader struct {
+	Peer  string
+	Since time.Time
+}
+
+// String representation of leader.
+func (l *Leader) String() string {
+	if l == nil {
+		return "leader: <nil>"
+	}
+	return fmt.Sprintf("leader: on peer: %v, since: %v", l.Peer, l.Since)
+}
+
+// LeaderEvent indicating that leadership has changed, or
+// some error has occured with the watch.
+type LeaderEvent struct {
+	// Leader after the change, nil if the leader was
+	// lost and no new leader has started yet.
+	Leader *Leader
+	err    error
+}
+
+// Err caught watching leadership. The error is an error
+// with the watch itself, after which the watch is closed.
+func (e *LeaderEvent) Err() error {
+	return e.err
+}
+
+// String representation of leader event.
+func (e *LeaderEvent) String() string {
+	if e == nil {
+		return "leader event: <nil>"
+	}
+	if e.err != nil {
+		return fmt.Sprintf("leader event: error: %v", e.err)
+	}
+	if e.Leader == nil {
+		return "leader event: leader lost"
+	}
+	return fmt.Sprintf("leader event: leader found: on peer: %v", e.Leader.Peer)
+}
+
+// Leader of this client's namespace. If no leader is
+// running the error ErrNoLeader is returned.
+func (c *Client) Leader(timeout time.Duration) (*Leader, error) {
+	timeoutC, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.LeaderC(timeoutC)
+}
+
+// LeaderC (leader) of this client's namespace. If no leader
+// is running the error ErrNoLeader is returned. The context
+// can be used to control cancelation or timeouts.
+func (c *Client) LeaderC(ctx context.Context) (*Leader, error) {
+	nsName, err := namespaceName(Actors, c.cfg.Namespace, leaderName)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := c.registry.FindRegistration(ctx, nsName)
+	if err == registry.ErrUnknownKey {
+		return nil, ErrNoLeader
+	}
+	if err != nil {
+		return nil, err
+	}
+	return leaderFromReg(reg), nil
+}
+
+// LeaderWatch monitors leadership of this client's namespace.
+// The current leader is returned, nil if none is running, and
+// each change of leadership is put on the channel.
+//
+// Example usage:
+//
+//     client, err := grid.NewClient(...)
+//     ...
+//
+//     leader, watch, err := client.LeaderWatch(ctx)
+//     ...
+//
+//     for event := range watch {
+//         if event.Err() != nil {
+//             // Error occured watching leadership, deal with error.
+//         }
+//         if event.Leader == nil {
+//             // Leader lost, a new one will be started.
+//         } else {
+//             // New leader on peer event.Leader.Peer.
+//         }
+//     }
+//
+// Like QueryWatch, the watch resumes after errors of the
+// underlying etcd watch, and an error is only sent once
+// resumption has failed repeatedly.
+func (c *Client) LeaderWatch(ctx context.Context) (*Leader, <-chan *LeaderEvent, error) {
+	nsName, err := namespaceName(Actors, c.cfg.Namespace, leaderName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The watch is of a prefix, so registrations of
+	// other actors whose names start with "leader"
+	// must be ignored.
+	regs, changes, err := c.registry.ResumeWatch(ctx, nsName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var current *Leader
+	for _, reg := range regs {
+		if reg.Key == nsName {
+			current = leaderFromReg(reg)
+		}
+	}
+	// Peer of the last leader sent, or of the current leader,
+	// since updates of the leader's registration in place, for
+	// example of its annotations, do not change leadership.
+	var lastPeer string
+	if current != nil {
+		lastPeer = current.Peer
+	}
+
+	leaderEvents := make(chan *LeaderEvent)
+	put := func(change *LeaderEvent) {
+		select {
+		case <-ctx.Done():
+		case leaderEvents <- change:
+		}
+	}
+	putTerminalError := func(change *LeaderEvent) {
+		go func() {
+			select {
+			case <-time.After(10 * time.Minute):
+			case leaderEvents <- change:
+			}
+		}()
+	}
+	go func() {
+		for {
+			select {
+			case change, open := <-changes:
+				if !open {
+					select {
+					case <-ctx.Done():
+					default:
+						putTerminalError(&LeaderEvent{err: ErrWatchClosedUnexpectedly})
+					}
+					return
+				}
+				if change.Error != nil {
+					putTerminalError(&LeaderEvent{err: watchError(change.Error)})
+					return
+				}
+				if change.Key != nsName {
+					continue
+				}
+				switch change.Type {
+				case registry.Delete:
+					lastPeer = ""
+					put(&LeaderEvent{})
+				case registry.Modify:
+					if change.Reg.Registry == lastPeer {
+						continue
+					}
+					fallthrough
+				case registry.Create:
+					lastPeer = change.Reg.Registry
+					put(&LeaderEvent{Leader: leaderFromReg(change.Reg)})
+				}
+			}
+		}
+	}()
+
+	return current, leaderEvents, nil
+}
+
+func leaderFromReg(reg *registry.Registration) *Leader {
+	return &Leader{
+		Peer:  reg.Registry,
+		Since: reg.Registered,
+	}
+}
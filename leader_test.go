@@ -0,0 +1,135 @@
+package grid
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+type leaderActor struct{}
+
+func (a *leaderActor) Act(c context.Context) {
+	<-c.Done()
+}
+
+func startLeaderTestServer(t *testing.T, server *Server) {
+	server.RegisterDef(leaderName, func(_ []byte) (Actor, error) { return &leaderActor{}, nil })
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+}
+
+func TestLeaderWatch(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	_, err := client.Leader(timeout)
+	if err != ErrNoLeader {
+		t.Fatalf("expected error: %v, found: %v", ErrNoLeader, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	current, watch, err := client.LeaderWatch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != nil {
+		t.Fatalf("expected no current leader, found: %v", current)
+	}
+
+	leading, err := NewServer(etcd, ServerCfg{Namespace: server.cfg.Namespace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startLeaderTestServer(t, leading)
+
+	nextEvent := func() *LeaderEvent {
+		select {
+		case <-time.After(20 * time.Second):
+			t.Fatal("timeout")
+		case e := <-watch:
+			if e.Err() != nil {
+				t.Fatal(e.Err())
+			}
+			return e
+		}
+		return nil
+	}
+
+	e := nextEvent()
+	if e.Leader == nil {
+		t.Fatal("expected leader found")
+	}
+	if e.Leader.Peer != leading.registry.Registry() {
+		t.Fatalf("expected leader on peer: %v, found: %v", leading.registry.Registry(), e.Leader.Peer)
+	}
+	if e.Leader.Since.IsZero() {
+		t.Fatal("expected leader start time")
+	}
+
+	leader, err := client.Leader(timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leader.Peer != e.Leader.Peer {
+		t.Fatalf("expected leader on peer: %v, found: %v", e.Leader.Peer, leader.Peer)
+	}
+
+	// Updating the leader's registration in
+	// place does not change leadership.
+	nsLeader, err := namespaceName(Actors, leading.cfg.Namespace, leaderName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateC, cancelUpdate := context.WithTimeout(context.Background(), timeout)
+	defer cancelUpdate()
+	err = leading.update(updateC, nsLeader, Update{Annotations: []string{"role=leader"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-watch:
+		t.Fatalf("expected no event for an update of the leader, found: %v", e)
+	case <-time.After(timeout):
+	}
+
+	leading.Stop()
+	e = nextEvent()
+	if e.Leader != nil {
+		t.Fatalf("expected leader lost, found: %v", e.Leader)
+	}
+}
+
+func TestServerDisalowLeadership(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	disallowed, err := NewServer(etcd, ServerCfg{Namespace: server.cfg.Namespace, DisalowLeadership: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disallowed.Stop()
+	startLeaderTestServer(t, disallowed)
+
+	// Leader startup is attempted after one second,
+	// so wait well past that.
+	time.Sleep(5 * time.Second)
+
+	_, err = client.Leader(timeout)
+	if err != ErrNoLeader {
+		t.Fatalf("expected error: %v, found: %v", ErrNoLeader, err)
+	}
+}
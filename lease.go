@@ -0,0 +1,105 @@
+package grid
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lytics/grid/registry"
+)
+
+// LeaseRecovery describes what was lost when the server recovered
+// from the loss of its registry lease, see ServerCfg.RecoverLease.
+type LeaseRecovery struct {
+	// LostActors by name, whose names were claimed by another
+	// peer while the lease was lost. Their contexts have been
+	// canceled.
+	LostActors []string
+	// LostMailboxes by name, whose names were claimed by another
+	// peer while the lease was lost. They have been closed.
+	LostMailboxes []string
+}
+
+// recoverLease of the registry after the keep alive fault, retrying
+// for up to the lease duration. The channel of the next keep alive
+// fault is returned.
+func (s *Server) recoverLease(fault error) (<-chan error, error) {
+	s.logf("%v: recovering lease after registry fault: %v", s.cfg.Namespace, fault)
+
+	deadline := time.Now().Add(s.cfg.LeaseDuration)
+	backoff := 1 * time.Second
+	for {
+		timeout, cancel := context.WithTimeout(s.ctx, s.cfg.Timeout)
+		lost, faults, err := s.registry.Recover(timeout)
+		cancel()
+		if err == nil {
+			return faults, s.handleLost(lost)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("lease recovery failed: %v", err)
+		}
+		s.logf("%v: retrying lease recovery after error: %v", s.cfg.Namespace, err)
+
+		select {
+		case <-s.ctx.Done():
+			return nil, nil
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > s.cfg.Timeout {
+			backoff = s.cfg.Timeout
+		}
+	}
+}
+
+// handleLost registrations after a recovery, by stopping the
+// actors and closing the mailboxes that were lost. Losing the
+// peer's own registration is an error.
+func (s *Server) handleLost(lost []*registry.Registration) error {
+	nsPeer, err := namespaceName(Peers, s.cfg.Namespace, s.registry.Registry())
+	if err != nil {
+		return err
+	}
+	actorPrefix, err := namespacePrefix(Actors, s.cfg.Namespace)
+	if err != nil {
+		return err
+	}
+	mailboxPrefix, err := namespacePrefix(Mailboxes, s.cfg.Namespace)
+	if err != nil {
+		return err
+	}
+
+	recovery := &LeaseRecovery{}
+	for _, reg := range lost {
+		switch {
+		case reg.Key == nsPeer:
+			return fmt.Errorf("lease recovery failed: peer registration lost: %v", reg.Key)
+		case strings.HasPrefix(reg.Key, actorPrefix):
+			name := nameFromKey(Actors, s.cfg.Namespace, reg.Key)
+			s.mu.Lock()
+			ra := s.running[name]
+			s.mu.Unlock()
+			if ra != nil {
+				ra.cancel()
+			}
+			s.logf("%v: lease recovery lost actor: %v", s.cfg.Namespace, name)
+			recovery.LostActors = append(recovery.LostActors, name)
+		case strings.HasPrefix(reg.Key, mailboxPrefix):
+			name := nameFromKey(Mailboxes, s.cfg.Namespace, reg.Key)
+			s.mu.Lock()
+			box := s.mailboxes[reg.Key]
+			s.mu.Unlock()
+			if box != nil {
+				box.Close()
+			}
+			s.logf("%v: lease recovery lost mailbox: %v", s.cfg.Namespace, name)
+			recovery.LostMailboxes = append(recovery.LostMailboxes, name)
+		}
+	}
+
+	if s.cfg.OnLeaseRecovery != nil {
+		s.cfg.OnLeaseRecovery(recovery)
+	}
+	return nil
+}
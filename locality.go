@@ -0,0 +1,126 @@
+package grid
+
+import (
+	"context"
+	"sort"
+)
+
+// unknownRank of receivers whose peer could not be found,
+// they are tried after receivers of every known locality.
+const unknownRank = -1
+
+// localityRank of a peer with the given annotations, which is
+// the number of the locality's annotations, from the most
+// significant, that the peer shares. For the locality
+// "zone=a", "rack=3" a peer in zone a and rack 3 ranks 2, a
+// peer in zone a and another rack ranks 1, and a peer in
+// another zone ranks 0.
+func localityRank(locality, annotations []string) int {
+	rank := 0
+	for _, l := range locality {
+		if !hasAnnotation(annotations, l) {
+			break
+		}
+		rank++
+	}
+	return rank
+}
+
+func hasAnnotation(annotations []string, a string) bool {
+	for _, v := range annotations {
+		if v == a {
+			return true
+		}
+	}
+	return false
+}
+
+// NearestPeers among the given peers, which are those sharing
+// the most of the client's locality. If no peer shares any of
+// it, or the client has no locality, all peers are returned.
+// Use it to place actors close to the client, for example:
+//
+//     peers, err := client.Query(timeout, grid.Peers)
+//     ...
+//     nearest := client.NearestPeers(peers)
+//     for i, start := range r.Actors() {
+//         _, err := client.Request(timeout, nearest[i%len(nearest)].Name(), start)
+//         ...
+//     }
+//
+func (c *Client) NearestPeers(peers []*QueryEvent) []*QueryEvent {
+	best := 0
+	for _, p := range peers {
+		if r := localityRank(c.cfg.Locality, p.Annotations()); r > best {
+			best = r
+		}
+	}
+	if best == 0 {
+		return peers
+	}
+	var nearest []*QueryEvent
+	for _, p := range peers {
+		if localityRank(c.cfg.Locality, p.Annotations()) == best {
+			nearest = append(nearest, p)
+		}
+	}
+	return nearest
+}
+
+// byLocality splits the receivers into tiers of equal locality
+// rank, nearest tier first.
+func (c *Client) byLocality(ctx context.Context, receivers []string) [][]string {
+	tiers := make(map[int][]string)
+	for _, r := range receivers {
+		rank := c.receiverRank(ctx, r)
+		tiers[rank] = append(tiers[rank], r)
+	}
+	ranks := make([]int, 0, len(tiers))
+	for rank := range tiers {
+		ranks = append(ranks, rank)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ranks)))
+
+	ordered := make([][]string, 0, len(ranks))
+	for _, rank := range ranks {
+		ordered = append(ordered, tiers[rank])
+	}
+	return ordered
+}
+
+// receiverRank of the peer hosting the receiver. The peer of
+// each receiver and the rank of each peer are cached, and kept
+// current by the client's watches of mailboxes and peers.
+func (c *Client) receiverRank(ctx context.Context, receiver string) int {
+	nsReceiver, err := namespaceName(Mailboxes, c.cfg.Namespace, receiver)
+	if err != nil {
+		return unknownRank
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	peer, ok := c.peers[nsReceiver]
+	if !ok {
+		reg, err := c.registry.FindRegistration(ctx, nsReceiver)
+		if err != nil {
+			return unknownRank
+		}
+		peer = reg.Registry
+		c.peers[nsReceiver] = peer
+	}
+	rank, ok := c.ranks[peer]
+	if !ok {
+		nsPeer, err := namespaceName(Peers, c.cfg.Namespace, peer)
+		if err != nil {
+			return unknownRank
+		}
+		reg, err := c.registry.FindRegistration(ctx, nsPeer)
+		if err != nil {
+			return unknownRank
+		}
+		rank = localityRank(c.cfg.Locality, reg.Annotations)
+		c.ranks[peer] = rank
+	}
+	return rank
+}
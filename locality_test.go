@@ -0,0 +1,74 @@
+package grid
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestLocalityRank(t *testing.T) {
+	locality := []string{"zone=a", "rack=3"}
+	cases := []struct {
+		annotations []string
+		expected    int
+	}{
+		{[]string{"zone=a", "rack=3"}, 2},
+		{[]string{"rack=3", "zone=a", "role=ingest"}, 2},
+		{[]string{"zone=a", "rack=4"}, 1},
+		{[]string{"zone=b", "rack=3"}, 0},
+		{nil, 0},
+	}
+	for _, c := range cases {
+		if r := localityRank(locality, c.annotations); r != c.expected {
+			t.Fatalf("expected rank: %v, for: %v, got: %v", c.expected, c.annotations, r)
+		}
+	}
+}
+
+func TestNearestPeers(t *testing.T) {
+	peers := []*QueryEvent{
+		{name: "peer-1", annotations: []string{"zone=b"}},
+		{name: "peer-2", annotations: []string{"zone=a", "rack=4"}},
+		{name: "peer-3", annotations: []string{"zone=a", "rack=4"}},
+	}
+
+	client := &Client{cfg: ClientCfg{Locality: []string{"zone=a", "rack=3"}}}
+	nearest := client.NearestPeers(peers)
+	if len(nearest) != 2 || nearest[0].Name() != "peer-2" || nearest[1].Name() != "peer-3" {
+		t.Fatalf("expected peers in zone a, got: %v", nearest)
+	}
+
+	// Without any peer sharing the locality
+	// all peers are returned.
+	client.cfg.Locality = []string{"zone=c"}
+	if len(client.NearestPeers(peers)) != len(peers) {
+		t.Fatal("expected all peers")
+	}
+}
+
+func TestByLocality(t *testing.T) {
+	namespace := newNamespace()
+	client := &Client{
+		cfg:   ClientCfg{Namespace: namespace, Locality: []string{"zone=a", "rack=3"}},
+		peers: make(map[string]string),
+		ranks: map[string]int{"peer-1": 0, "peer-2": 2, "peer-3": 1},
+	}
+	for receiver, peer := range map[string]string{
+		"actor-1": "peer-1",
+		"actor-2": "peer-2",
+		"actor-3": "peer-3",
+		"actor-4": "peer-2",
+	} {
+		nsReceiver, err := namespaceName(Mailboxes, namespace, receiver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.peers[nsReceiver] = peer
+	}
+
+	tiers := client.byLocality(context.Background(), []string{"actor-1", "actor-2", "actor-3", "actor-4"})
+	expected := [][]string{{"actor-2", "actor-4"}, {"actor-3"}, {"actor-1"}}
+	if !reflect.DeepEqual(tiers, expected) {
+		t.Fatalf("expected tiers: %v, got: %v", expected, tiers)
+	}
+}
@@ -0,0 +1,201 @@
+package grid
+
+import (
+	"context"
+	"time"
+
+	"github.com/lytics/grid/registry"
+)
+
+const (
+	// locks and semaphores entities, which are not
+	// queryable, but are namespaced like the others.
+	locks      EntityType = "lock"
+	semaphores EntityType = "semaphore"
+
+	// defaultLockTTL when a lock or semaphore is used
+	// with a TTL of zero.
+	defaultLockTTL = 10 * time.Second
+)
+
+// Lock held in the client's namespace, see Client.Lock.
+type Lock struct {
+	name   string
+	permit *registry.Permit
+}
+
+// Name of the lock.
+func (l *Lock) Name() string {
+	return l.name
+}
+
+// Token fencing the holder of the lock. Each holder of the lock
+// gets a larger token than the previous holders, so stores used
+// under the lock can reject writes made with a smaller token.
+func (l *Lock) Token() int64 {
+	return l.permit.Token
+}
+
+// Done is closed when the lock is unlocked, or lost because its
+// lease could not be kept alive, in which case the holder must
+// stop using the resource the lock protects.
+func (l *Lock) Done() <-chan struct{} {
+	return l.permit.Done()
+}
+
+// Unlock the lock.
+func (l *Lock) Unlock(c context.Context) error {
+	return l.permit.Release(c)
+}
+
+// Lock the named lock in the client's namespace, waiting until it
+// is available or the context is done. The lock is bound to a lease
+// of its own, kept alive until Unlock is called, so if the holder
+// dies the lock is released within the TTL, regardless of the lease
+// of any peer. A TTL of zero uses the default of 10 seconds.
+//
+// Example usage:
+//
+//     lock, err := client.Lock(ctx, "billing-export", 0)
+//     ...
+//     defer lock.Unlock(context.Background())
+//
+//     select {
+//     case <-lock.Done():
+//         // Lock lost, stop using the resource.
+//     case ...
+//     }
+//
+func (c *Client) Lock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return c.lock(ctx, name, ttl, true)
+}
+
+// TryLock the named lock in the client's namespace, like Lock, but
+// return ErrLocked instead of waiting if the lock is held.
+func (c *Client) TryLock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return c.lock(ctx, name, ttl, false)
+}
+
+func (c *Client) lock(ctx context.Context, name string, ttl time.Duration, wait bool) (*Lock, error) {
+	nsName, err := namespaceName(locks, c.cfg.Namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	permit, err := c.acquire(ctx, nsName, 1, ttl, wait)
+	if err == ErrNoPermits {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Lock{name: name, permit: permit}, nil
+}
+
+// Semaphore in the client's namespace, with a number of permits
+// which can be held at the same time, see Client.Semaphore.
+type Semaphore struct {
+	name    string
+	nsName  string
+	permits int
+	ttl     time.Duration
+	client  *Client
+}
+
+// Permit of a semaphore.
+type Permit struct {
+	permit *registry.Permit
+}
+
+// Token fencing the holder of the permit, see Lock.Token.
+func (p *Permit) Token() int64 {
+	return p.permit.Token
+}
+
+// Done is closed when the permit is released, or lost because
+// its lease could not be kept alive.
+func (p *Permit) Done() <-chan struct{} {
+	return p.permit.Done()
+}
+
+// Release the permit.
+func (p *Permit) Release(c context.Context) error {
+	return p.permit.Release(c)
+}
+
+// Semaphore named in the client's namespace, of which up to the
+// given number of permits can be held at once. Every user of the
+// semaphore must use the same number of permits. The TTL is used
+// for each permit as for Lock.
+//
+// Example usage:
+//
+//     sem, err := client.Semaphore("crawler", 4, 0)
+//     ...
+//     permit, err := sem.Acquire(ctx)
+//     ...
+//     defer permit.Release(context.Background())
+//
+func (c *Client) Semaphore(name string, permits int, ttl time.Duration) (*Semaphore, error) {
+	nsName, err := namespaceName(semaphores, c.cfg.Namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if permits < 1 {
+		return nil, ErrInvalidPermits
+	}
+	return &Semaphore{
+		name:    name,
+		nsName:  nsName,
+		permits: permits,
+		ttl:     ttl,
+		client:  c,
+	}, nil
+}
+
+// Name of the semaphore.
+func (s *Semaphore) Name() string {
+	return s.name
+}
+
+// Acquire a permit, waiting until one is available or the
+// context is done.
+func (s *Semaphore) Acquire(ctx context.Context) (*Permit, error) {
+	permit, err := s.client.acquire(ctx, s.nsName, s.permits, s.ttl, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Permit{permit: permit}, nil
+}
+
+// TryAcquire a permit, like Acquire, but return ErrNoPermits
+// instead of waiting if none is available.
+func (s *Semaphore) TryAcquire(ctx context.Context) (*Permit, error) {
+	permit, err := s.client.acquire(ctx, s.nsName, s.permits, s.ttl, false)
+	if err != nil {
+		return nil, err
+	}
+	return &Permit{permit: permit}, nil
+}
+
+// acquire a permit of the semaphore, or lock, with the namespaced name.
+func (c *Client) acquire(ctx context.Context, nsName string, permits int, ttl time.Duration, wait bool) (*registry.Permit, error) {
+	if ttl == 0 {
+		ttl = defaultLockTTL
+	}
+	var permit *registry.Permit
+	var err error
+	if wait {
+		permit, err = c.registry.Acquire(ctx, nsName+".", permits, ttl)
+	} else {
+		permit, err = c.registry.TryAcquire(ctx, nsName+".", permits, ttl)
+	}
+	switch err {
+	case registry.ErrNoPermits:
+		return nil, ErrNoPermits
+	case registry.ErrInvalidTTL:
+		return nil, ErrInvalidTTL
+	case context.Canceled, context.DeadlineExceeded:
+		return nil, ErrContextFinished
+	}
+	return permit, err
+}
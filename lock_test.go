@@ -0,0 +1,81 @@
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLockUnlock(t *testing.T) {
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lock, err := client.Lock(ctx, "exclusive", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Name() != "exclusive" {
+		t.Fatalf("expected lock name: exclusive, found: %v", lock.Name())
+	}
+	_, err = client.TryLock(ctx, "exclusive", 0)
+	if err != ErrLocked {
+		t.Fatalf("expected error: %v, found: %v", ErrLocked, err)
+	}
+
+	// Locks are namespaced by name, another
+	// name is a separate lock.
+	other, err := client.TryLock(ctx, "exclusive-other", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Unlock(ctx)
+
+	err = lock.Unlock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := client.TryLock(ctx, "exclusive", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Unlock(ctx)
+	if next.Token() <= lock.Token() {
+		t.Fatalf("expected token larger than: %v, found: %v", lock.Token(), next.Token())
+	}
+}
+
+func TestSemaphore(t *testing.T) {
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	_, err := client.Semaphore("pool", 0, 0)
+	if err != ErrInvalidPermits {
+		t.Fatalf("expected error: %v, found: %v", ErrInvalidPermits, err)
+	}
+	sem, err := client.Semaphore("pool", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		permit, err := sem.TryAcquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer permit.Release(ctx)
+	}
+	_, err = sem.TryAcquire(ctx)
+	if err != ErrNoPermits {
+		t.Fatalf("expected error: %v, found: %v", ErrNoPermits, err)
+	}
+}
@@ -8,13 +8,16 @@ import (
 
 // Mailbox for receiving messages.
 type Mailbox struct {
-	mu      sync.RWMutex
-	name    string
-	nsName  string
-	C       <-chan Request
-	c       chan Request
-	closed  bool
-	cleanup func() error
+	mu          sync.RWMutex
+	name        string
+	nsName      string
+	C           <-chan Request
+	c           chan Request
+	closed      bool
+	cleanup     func() error
+	token       func() (int64, bool)
+	update      func(context.Context, Update) error
+	annotations []string
 }
 
 // Close the mailbox.
@@ -22,6 +25,13 @@ func (box *Mailbox) Close() error {
 	box.mu.Lock()
 	defer box.mu.Unlock()
 
+	// The server closes mailboxes whose registration
+	// was lost, see ServerCfg.RecoverLease, so the
+	// owner's close may be the second.
+	if box.closed {
+		return nil
+	}
+
 	// Close mailbox.
 	box.closed = true
 	close(box.c)
@@ -30,6 +40,24 @@ func (box *Mailbox) Close() error {
 	return box.cleanup()
 }
 
+// Annotations the mailbox was registered, or last updated, with.
+func (box *Mailbox) Annotations() []string {
+	box.mu.RLock()
+	defer box.mu.RUnlock()
+	return box.annotations
+}
+
+// Token fencing the mailbox's registration, see ContextActorToken.
+// The error ErrOwnershipLost is returned once the mailbox no longer
+// owns its name.
+func (box *Mailbox) Token() (int64, error) {
+	token, ok := box.token()
+	if !ok {
+		return 0, ErrOwnershipLost
+	}
+	return token, nil
+}
+
 // Name of mailbox, without namespace.
 func (box *Mailbox) Name() string {
 	return box.name
@@ -79,13 +107,18 @@ func (box *Mailbox) put(req *request) error {
 //         }
 //     }
 //
+// Annotations, such as "role=ingest" or "version=2", are stored in the
+// mailbox's registration and returned by the client's Query methods:
+//
+//     mailbox, err := NewMailbox(server, "incoming", 10, "role=ingest")
+//
 // If the mailbox has already been created, in the calling process or
 // any other process, an error is returned, since only one mailbox
 // can claim a particular name.
 //
 // Using a mailbox requires that the process creating the mailbox also
 // started a grid Server.
-func NewMailbox(s *Server, name string, size int) (*Mailbox, error) {
+func NewMailbox(s *Server, name string, size int, annotations ...string) (*Mailbox, error) {
 	if !isNameValid(name) {
 		return nil, ErrInvalidMailboxName
 	}
@@ -96,10 +129,10 @@ func NewMailbox(s *Server, name string, size int) (*Mailbox, error) {
 		return nil, err
 	}
 
-	return newMailbox(s, name, nsName, size)
+	return newMailbox(s, name, nsName, size, annotations)
 }
 
-func newMailbox(s *Server, name, nsName string, size int) (*Mailbox, error) {
+func newMailbox(s *Server, name, nsName string, size int, annotations []string) (*Mailbox, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -113,7 +146,7 @@ func newMailbox(s *Server, name, nsName string, size int) (*Mailbox, error) {
 	}
 
 	timeout, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
-	err := s.registry.Register(timeout, nsName)
+	err := s.registry.Register(timeout, nsName, annotations...)
 	cancel()
 	// Check if the error is a particular fatal error
 	// from etcd. Some errors have no recovery. See
@@ -123,7 +156,10 @@ func newMailbox(s *Server, name, nsName string, size int) (*Mailbox, error) {
 	//
 	// They are unfortunately not classidied into
 	// recoverable or non-recoverable.
-	if err != nil && strings.Contains(err.Error(), "etcdserver: requested lease not found") {
+	//
+	// In recovery mode the lost lease is instead recovered
+	// once its keep alive fails, see ServerCfg.RecoverLease.
+	if err != nil && strings.Contains(err.Error(), "etcdserver: requested lease not found") && !s.cfg.RecoverLease {
 		s.reportFatalError(err)
 		return nil, err
 	}
@@ -149,11 +185,14 @@ func newMailbox(s *Server, name, nsName string, size int) (*Mailbox, error) {
 		return err
 	}
 	box := &Mailbox{
-		name:    name,
-		nsName:  nsName,
-		C:       boxC,
-		c:       boxC,
-		cleanup: cleanup,
+		name:        name,
+		nsName:      nsName,
+		C:           boxC,
+		c:           boxC,
+		cleanup:     cleanup,
+		token:       func() (int64, bool) { return s.registry.Token(nsName) },
+		update:      func(c context.Context, u Update) error { return s.update(c, nsName, u) },
+		annotations: annotations,
 	}
 	s.mailboxes[nsName] = box
 	return box, nil
@@ -0,0 +1,67 @@
+package grid
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lytics/grid/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// serverOptions of the gRPC server, from the config.
+func serverOptions(cfg ServerCfg) []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if cfg.MaxMessageSize > 0 {
+		opts = append(opts,
+			grpc.MaxRecvMsgSize(cfg.MaxMessageSize),
+			grpc.MaxSendMsgSize(cfg.MaxMessageSize))
+	}
+	if cfg.Keepalive != (keepalive.ServerParameters{}) {
+		opts = append(opts, grpc.KeepaliveParams(cfg.Keepalive))
+	}
+	if cfg.KeepaliveEnforcement != (keepalive.EnforcementPolicy{}) {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(cfg.KeepaliveEnforcement))
+	}
+	if cfg.InitialWindowSize > 0 {
+		opts = append(opts, grpc.InitialWindowSize(cfg.InitialWindowSize))
+	}
+	if cfg.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.InitialConnWindowSize(cfg.InitialConnWindowSize))
+	}
+	return append(opts, cfg.ServerOptions...)
+}
+
+// dialOptions of connections to peers, from the config.
+func dialOptions(cfg ClientCfg) []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithBackoffMaxDelay(20 * time.Second),
+		grpc.WithDialer(dial),
+	}
+	if cfg.MaxMessageSize > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(cfg.MaxMessageSize),
+			grpc.MaxCallSendMsgSize(cfg.MaxMessageSize)))
+	}
+	if cfg.Keepalive != (keepalive.ClientParameters{}) {
+		opts = append(opts, grpc.WithKeepaliveParams(cfg.Keepalive))
+	}
+	if cfg.InitialWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialWindowSize(cfg.InitialWindowSize))
+	}
+	if cfg.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialConnWindowSize(cfg.InitialConnWindowSize))
+	}
+	return append(opts, cfg.DialOptions...)
+}
+
+// dial the address of a peer, which is either host:port
+// or unix://path.
+func dial(address string, timeout time.Duration) (net.Conn, error) {
+	if strings.HasPrefix(address, registry.UnixScheme) {
+		return net.DialTimeout("unix", strings.TrimPrefix(address, registry.UnixScheme), timeout)
+	}
+	return net.DialTimeout("tcp", address, timeout)
+}
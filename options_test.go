@@ -0,0 +1,46 @@
+package grid
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+func TestServerOptions(t *testing.T) {
+	if n := len(serverOptions(ServerCfg{})); n != 0 {
+		t.Fatalf("expected no options by default, got: %v", n)
+	}
+
+	opts := serverOptions(ServerCfg{
+		MaxMessageSize:        16 * 1024 * 1024,
+		Keepalive:             keepalive.ServerParameters{Time: time.Minute},
+		KeepaliveEnforcement:  keepalive.EnforcementPolicy{MinTime: time.Second},
+		InitialWindowSize:     1 << 20,
+		InitialConnWindowSize: 1 << 20,
+		ServerOptions:         []grpc.ServerOption{grpc.MaxRecvMsgSize(1)},
+	})
+	// Two for the message size, one for each
+	// other field, and the extra option.
+	if len(opts) != 7 {
+		t.Fatalf("expected 7 options, got: %v", len(opts))
+	}
+}
+
+func TestDialOptions(t *testing.T) {
+	if n := len(dialOptions(ClientCfg{})); n != 3 {
+		t.Fatalf("expected 3 default options, got: %v", n)
+	}
+
+	opts := dialOptions(ClientCfg{
+		MaxMessageSize:        16 * 1024 * 1024,
+		Keepalive:             keepalive.ClientParameters{Time: time.Minute},
+		InitialWindowSize:     1 << 20,
+		InitialConnWindowSize: 1 << 20,
+		DialOptions:           []grpc.DialOption{grpc.WithBlock()},
+	})
+	if len(opts) != 8 {
+		t.Fatalf("expected 8 options, got: %v", len(opts))
+	}
+}
@@ -0,0 +1,124 @@
+package grid
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/lytics/grid/registry"
+)
+
+// peerSchemas published in the registration of a peer, as
+// cached by the client, see ClientCfg.CheckSchemas.
+type peerSchemas struct {
+	// revision of the registration the schemas are from,
+	// so that an older read never replaces a newer one.
+	revision int64
+	schemas  map[string]string
+	// expires, if not zero, when reading the schemas failed,
+	// and they should be read again.
+	expires time.Time
+}
+
+// watchPeers of the namespace, keeping what the client caches of
+// the registrations of peers, their schemas and locality ranks, in
+// step with the registry until the context is done. A peer which
+// restarts, or updates its schemas, has a new revision, so the cache
+// never holds schemas of another registration than the current one.
+func (c *Client) watchPeers(ctx context.Context) {
+	nsPrefix, err := namespacePrefix(Peers, c.cfg.Namespace)
+	if err != nil {
+		c.logf("failed watching peers: %v", err)
+		return
+	}
+
+	for {
+		err := c.watchPeersOnce(ctx, nsPrefix)
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		// While not watching, the cache could go stale
+		// without the client knowing, so drop it and
+		// fall back to reading peers on demand.
+		c.mu.Lock()
+		c.schemas = make(map[string]*peerSchemas)
+		c.ranks = make(map[string]int)
+		c.mu.Unlock()
+		c.logf("watch of peers failed, restarting: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.cfg.Timeout):
+		}
+	}
+}
+
+// watchPeersOnce fills the cache with the current peers and
+// applies changes until the watch fails.
+func (c *Client) watchPeersOnce(ctx context.Context, nsPrefix string) error {
+	regs, changes, err := c.registry.ResumeWatch(ctx, nsPrefix)
+	if err != nil {
+		return err
+	}
+
+	for _, reg := range regs {
+		c.updatePeer(strings.TrimPrefix(reg.Key, nsPrefix), reg)
+	}
+	for change := range changes {
+		if change.Error != nil {
+			return change.Error
+		}
+		peer := strings.TrimPrefix(change.Key, nsPrefix)
+		switch change.Type {
+		case registry.Delete:
+			c.evictPeer(peer)
+		case registry.Create, registry.Modify:
+			c.updatePeer(peer, change.Reg)
+		}
+	}
+	return ErrWatchClosedUnexpectedly
+}
+
+func (c *Client) updatePeer(peer string, reg *registry.Registration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cfg.CheckSchemas {
+		c.setSchemas(peer, reg)
+	}
+	// Annotations can change in place, see Server.UpdatePeer,
+	// so the rank is recomputed from every registration.
+	if len(c.cfg.Locality) > 0 {
+		c.ranks[peer] = localityRank(c.cfg.Locality, reg.Annotations)
+	}
+}
+
+func (c *Client) evictPeer(peer string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.schemas, peer)
+	delete(c.ranks, peer)
+}
+
+// setSchemas of the peer from its registration, unless a newer
+// revision is cached. Must be called with the client's lock held.
+func (c *Client) setSchemas(peer string, reg *registry.Registration) {
+	if ps, ok := c.schemas[peer]; ok && ps.revision > reg.Revision {
+		return
+	}
+	c.schemas[peer] = &peerSchemas{revision: reg.Revision, schemas: reg.Schemas}
+}
+
+// hasSchemas returns true if the schemas of the peer are cached
+// and have not expired. Must be called with the client's lock held.
+func (c *Client) hasSchemas(peer string) bool {
+	ps, ok := c.schemas[peer]
+	if !ok {
+		return false
+	}
+	return ps.expires.IsZero() || time.Now().Before(ps.expires)
+}
@@ -0,0 +1,72 @@
+package grid
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lytics/grid/registry"
+)
+
+func TestClientPeerSchemas(t *testing.T) {
+	client := &Client{
+		cfg:     ClientCfg{CheckSchemas: true},
+		schemas: map[string]*peerSchemas{},
+	}
+
+	if client.hasSchemas("peer-1") {
+		t.Fatal("expected no schemas")
+	}
+
+	// A newer registration replaces an older one, not
+	// the other way round.
+	client.updatePeer("peer-1", &registry.Registration{Revision: 2, Schemas: map[string]string{"new": "0"}})
+	client.updatePeer("peer-1", &registry.Registration{Revision: 1, Schemas: map[string]string{"old": "0"}})
+	if !client.hasSchemas("peer-1") {
+		t.Fatal("expected schemas")
+	}
+	if _, ok := client.schemas["peer-1"].schemas["new"]; !ok {
+		t.Fatalf("expected schemas of revision 2, found: %v", client.schemas["peer-1"])
+	}
+
+	client.evictPeer("peer-1")
+	if client.hasSchemas("peer-1") {
+		t.Fatal("expected schemas to be evicted")
+	}
+
+	// A failed read expires.
+	client.schemas["peer-2"] = &peerSchemas{expires: time.Now().Add(-time.Second)}
+	if client.hasSchemas("peer-2") {
+		t.Fatal("expected failed read to expire")
+	}
+	client.schemas["peer-2"] = &peerSchemas{expires: time.Now().Add(time.Minute)}
+	if !client.hasSchemas("peer-2") {
+		t.Fatal("expected failed read to be cached")
+	}
+}
+
+func TestClientPeerRanks(t *testing.T) {
+	client := &Client{
+		cfg:     ClientCfg{Locality: []string{"zone=a", "rack=3"}},
+		schemas: map[string]*peerSchemas{},
+		ranks:   map[string]int{},
+	}
+
+	client.updatePeer("peer-1", &registry.Registration{Annotations: []string{"zone=a", "rack=4"}})
+	if rank := client.ranks["peer-1"]; rank != 1 {
+		t.Fatalf("expected rank: 1, found: %v", rank)
+	}
+
+	// The peer's annotations change in place.
+	client.updatePeer("peer-1", &registry.Registration{Annotations: []string{"zone=a", "rack=3"}})
+	if rank := client.ranks["peer-1"]; rank != 2 {
+		t.Fatalf("expected rank: 2, found: %v", rank)
+	}
+
+	client.evictPeer("peer-1")
+	if _, ok := client.ranks["peer-1"]; ok {
+		t.Fatal("expected rank to be evicted")
+	}
+	if _, ok := client.schemas["peer-1"]; ok {
+		t.Fatal("expected no schemas without CheckSchemas")
+	}
+}
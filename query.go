@@ -19,17 +19,32 @@ const (
 	Mailboxes EntityType = "mailbox"
 )
 
+// SlowWatcherPolicy of a client, for watches whose buffer
+// is full, see ClientCfg.WatchBuffer.
+type SlowWatcherPolicy int
+
+const (
+	// DisconnectSlowWatcher sends the watcher, after the events
+	// already buffered, a WatchError with ErrSlowWatcher, and
+	// closes its channel. Other watches are unaffected.
+	DisconnectSlowWatcher = SlowWatcherPolicy(registry.DisconnectSlowSubscriber)
+	// BlockOnSlowWatcher waits for room in the watcher's buffer,
+	// which holds up every watch of the same entities.
+	BlockOnSlowWatcher = SlowWatcherPolicy(registry.BlockOnSlowSubscriber)
+)
+
 // EventType categorizing the event.
 type EventType int
 
 const (
-	WatchError  EventType = 0
-	EntityLost  EventType = 1
-	EntityFound EventType = 2
+	WatchError    EventType = 0
+	EntityLost    EventType = 1
+	EntityFound   EventType = 2
+	EntityUpdated EventType = 3
 )
 
 // QueryEvent indicating that an entity has been discovered,
-// lost, or some error has occured with the watch.
+// lost, updated, or some error has occured with the watch.
 type QueryEvent struct {
 	name        string
 	peer        string
@@ -37,6 +52,7 @@ type QueryEvent struct {
 	entity      EntityType
 	Type        EventType
 	annotations []string
+	status      string
 }
 
 // Name of entity that caused the event. For example, if
@@ -53,8 +69,9 @@ func (e *QueryEvent) Peer() string {
 	return e.peer
 }
 
-// Annotations of named entity.
-// Currently only used by Peers as an option to the grid server.
+// Annotations of named entity. Peers are annotated by the
+// grid server's config, actors by ActorStart.Annotations,
+// and mailboxes by the annotations passed to NewMailbox.
 func (e *QueryEvent) Annotations() []string {
 	return e.annotations
 }
@@ -77,6 +94,8 @@ func (e *QueryEvent) String() string {
 		return fmt.Sprintf("query event: %v lost: %v", e.entity, e.name)
 	case EntityFound:
 		return fmt.Sprintf("query event: %v found: %v, on peer: %v", e.entity, e.name, e.peer)
+	case EntityUpdated:
+		return fmt.Sprintf("query event: %v updated: %v, on peer: %v, status: %v", e.entity, e.name, e.peer, e.Status())
 	default:
 		return fmt.Sprintf("query event: error: %v", e.err)
 	}
@@ -104,24 +123,67 @@ func (e *QueryEvent) String() string {
 //             // Existing peer lost, reschedule work on extant peers.
 //         case grid.EntityFound:
 //             // New peer found, assign work, get data, reschedule, etc.
+//         case grid.EntityUpdated:
+//             // Existing peer's status or annotations changed.
 //         }
 //     }
+//
+// If the underlying etcd watch closes or errors, the watch resumes
+// from the last revision seen. If that revision has been compacted,
+// the entities are listed again, and the changes since the last event
+// are sent as found, lost, and updated events. A WatchError is only
+// sent once resumption has failed repeatedly.
+//
+// Watches of the same entities in the same client share one etcd
+// watch. Each has a buffer of ClientCfg.WatchBuffer events, and by
+// default a watch which falls further behind is sent a WatchError
+// with ErrSlowWatcher, see ClientCfg.SlowWatcherPolicy.
 func (c *Client) QueryWatch(ctx context.Context, filter EntityType) ([]*QueryEvent, <-chan *QueryEvent, error) {
+	return c.QueryWatchBy(ctx, NewQuery(filter))
+}
+
+// QueryWatchBy monitors the entry and exit of the entities matching
+// the query, see QueryWatch. Only matching entities are returned and
+// put on the channel. An entity whose registration is modified, see
+// Update, is reported as updated while it still matches, as lost once
+// it stops matching, and as found once it starts matching.
+func (c *Client) QueryWatchBy(ctx context.Context, q *Query) ([]*QueryEvent, <-chan *QueryEvent, error) {
+	if err := q.validate(); err != nil {
+		return nil, nil, err
+	}
+	filter := q.entity
 	nsName, err := namespacePrefix(filter, c.cfg.Namespace)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	regs, changes, err := c.registry.Watch(ctx, nsName)
+	regs, changes, err := c.registry.ResumeWatch(ctx, nsName+q.prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Names of the entities currently matching,
+	// so that lost events, which may not carry
+	// the registration, can be filtered.
+	matching := make(map[string]bool)
+
 	var current []*QueryEvent
 	for _, reg := range regs {
-		current = append(current, &QueryEvent{
+		qe := &QueryEvent{
 			name:        nameFromKey(filter, c.cfg.Namespace, reg.Key),
 			peer:        reg.Registry,
 			entity:      filter,
 			annotations: reg.Annotations,
+			status:      reg.Status,
 			Type:        EntityFound,
-		})
+		}
+		if filter == Peers {
+			qe.peer = qe.name
+		}
+		if q.matches(qe) {
+			matching[qe.name] = true
+			current = append(current, qe)
+		}
 	}
 
 	queryEvents := make(chan *QueryEvent)
@@ -152,19 +214,25 @@ func (c *Client) QueryWatch(ctx context.Context, filter EntityType) ([]*QueryEve
 					return
 				}
 				if change.Error != nil {
-					putTerminalError(&QueryEvent{err: change.Error})
+					putTerminalError(&QueryEvent{err: watchError(change.Error)})
 					return
 				}
 				switch change.Type {
 				case registry.Delete:
 					annotations := []string{}
+					peer := ""
+					status := ""
 					if change.Reg != nil {
 						annotations = change.Reg.Annotations
+						peer = change.Reg.Registry
+						status = change.Reg.Status
 					}
 					qe := &QueryEvent{
 						name:        nameFromKey(filter, c.cfg.Namespace, change.Key),
+						peer:        peer,
 						entity:      filter,
 						annotations: annotations,
+						status:      status,
 						Type:        EntityLost,
 					}
 					// Maintain contract that for peer events
@@ -178,6 +246,10 @@ func (c *Client) QueryWatch(ctx context.Context, filter EntityType) ([]*QueryEve
 					if filter == Peers {
 						qe.peer = qe.name
 					}
+					if !matching[qe.name] {
+						continue
+					}
+					delete(matching, qe.name)
 					put(qe)
 				case registry.Create, registry.Modify:
 					qe := &QueryEvent{
@@ -185,6 +257,7 @@ func (c *Client) QueryWatch(ctx context.Context, filter EntityType) ([]*QueryEve
 						peer:        change.Reg.Registry,
 						entity:      filter,
 						annotations: change.Reg.Annotations,
+						status:      change.Reg.Status,
 						Type:        EntityFound,
 					}
 					// Maintain contract that for peer events
@@ -198,6 +271,18 @@ func (c *Client) QueryWatch(ctx context.Context, filter EntityType) ([]*QueryEve
 					if filter == Peers {
 						qe.peer = qe.name
 					}
+					if !q.matches(qe) {
+						if matching[qe.name] {
+							delete(matching, qe.name)
+							qe.Type = EntityLost
+							put(qe)
+						}
+						continue
+					}
+					if change.Type == registry.Modify && matching[qe.name] {
+						qe.Type = EntityUpdated
+					}
+					matching[qe.name] = true
 					put(qe)
 				}
 			}
@@ -207,6 +292,14 @@ func (c *Client) QueryWatch(ctx context.Context, filter EntityType) ([]*QueryEve
 	return current, queryEvents, nil
 }
 
+// watchError of the registry, as an error of grid.
+func watchError(err error) error {
+	if err == registry.ErrSlowSubscriber {
+		return ErrSlowWatcher
+	}
+	return err
+}
+
 // Query in this client's namespace. The filter can be any one of
 // Peers, Actors, or Mailboxes.
 func (c *Client) Query(timeout time.Duration, filter EntityType) ([]*QueryEvent, error) {
@@ -219,23 +312,47 @@ func (c *Client) Query(timeout time.Duration, filter EntityType) ([]*QueryEvent,
 // one of Peers, Actors, or Mailboxes. The context can be used to
 // control cancelation or timeouts.
 func (c *Client) QueryC(ctx context.Context, filter EntityType) ([]*QueryEvent, error) {
+	return c.QueryByC(ctx, NewQuery(filter))
+}
+
+// QueryBy returns the entities in this client's namespace
+// which match the query.
+func (c *Client) QueryBy(timeout time.Duration, q *Query) ([]*QueryEvent, error) {
+	timeoutC, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.QueryByC(timeoutC, q)
+}
+
+// QueryByC (query by) returns the entities in this client's namespace
+// which match the query. The context can be used to control cancelation
+// or timeouts.
+func (c *Client) QueryByC(ctx context.Context, q *Query) ([]*QueryEvent, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	filter := q.entity
 	nsPrefix, err := namespacePrefix(filter, c.cfg.Namespace)
 	if err != nil {
 		return nil, err
 	}
-	regs, err := c.registry.FindRegistrations(ctx, nsPrefix)
+	regs, err := c.registry.FindRegistrations(ctx, nsPrefix+q.prefix)
 	if err != nil {
 		return nil, err
 	}
 
 	var result []*QueryEvent
 	for _, reg := range regs {
-		result = append(result, &QueryEvent{
-			name:   nameFromKey(filter, c.cfg.Namespace, reg.Key),
-			peer:   reg.Registry,
-			entity: filter,
-			Type:   EntityFound,
-		})
+		qe := &QueryEvent{
+			name:        nameFromKey(filter, c.cfg.Namespace, reg.Key),
+			peer:        reg.Registry,
+			entity:      filter,
+			annotations: reg.Annotations,
+			status:      reg.Status,
+			Type:        EntityFound,
+		}
+		if q.matches(qe) {
+			result = append(result, qe)
+		}
 	}
 
 	return result, nil
@@ -2,7 +2,9 @@ package grid
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -138,3 +140,194 @@ func TestQueryWatch(t *testing.T) {
 		}
 	}
 }
+
+type annotatedActor struct {
+	ready  chan bool
+	server *Server
+}
+
+func (a *annotatedActor) Act(c context.Context) {
+	mailbox, err := NewMailbox(a.server, "annotated-mailbox", 1, "role=ingest")
+	if err != nil {
+		return
+	}
+	defer mailbox.Close()
+
+	a.ready <- true
+	<-c.Done()
+}
+
+func TestQueryAnnotations(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	a := &annotatedActor{ready: make(chan bool), server: server}
+	server.RegisterDef("annotated", func(_ []byte) (Actor, error) { return a, nil })
+
+	peers, err := client.Query(timeout, Peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 {
+		t.Fatal("expected 1 peer")
+	}
+
+	start := NewActorStart("annotated")
+	start.Annotations = []string{"role=leader", "version=2"}
+	_, err = client.Request(timeout, peers[0].Name(), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-a.ready
+
+	expected := map[EntityType][]string{
+		Actors:    {"role=leader", "version=2"},
+		Mailboxes: {"role=ingest"},
+	}
+	names := map[EntityType]string{
+		Actors:    "annotated",
+		Mailboxes: "annotated-mailbox",
+	}
+	for filter, annotations := range expected {
+		res, err := client.Query(timeout, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found *QueryEvent
+		for _, e := range res {
+			if e.Name() == names[filter] {
+				found = e
+			}
+		}
+		if found == nil {
+			t.Fatalf("expected to find %v: %v", filter, names[filter])
+		}
+		if strings.Join(found.Annotations(), ",") != strings.Join(annotations, ",") {
+			t.Fatalf("expected %v annotations: %v, got: %v", filter, annotations, found.Annotations())
+		}
+	}
+}
+
+func TestQueryBy(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	a := &annotatedActor{ready: make(chan bool), server: server}
+	server.RegisterDef("annotated", func(_ []byte) (Actor, error) { return a, nil })
+
+	peers, err := client.Query(timeout, Peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 {
+		t.Fatal("expected 1 peer")
+	}
+
+	// Watch for the mailbox before it exists.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := NewQuery(Mailboxes).Peer(peers[0].Name()).Annotation("role", "ingest")
+	current, watch, err := client.QueryWatchBy(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 0 {
+		t.Fatalf("expected no matching mailboxes, found: %v", len(current))
+	}
+
+	_, err = client.Request(timeout, peers[0].Name(), NewActorStart("annotated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-a.ready
+
+	// The peer's own mailbox is not annotated, so
+	// only the actor's mailbox is put on the watch.
+	select {
+	case e := <-watch:
+		if e.Type != EntityFound || e.Name() != "annotated-mailbox" {
+			t.Fatalf("expected annotated mailbox found, got: %v", e)
+		}
+	case <-time.After(timeout):
+		t.Fatal("expected watch event")
+	}
+
+	res, err := client.QueryBy(timeout, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Name() != "annotated-mailbox" {
+		t.Fatalf("expected only the annotated mailbox, got: %v", res)
+	}
+
+	res, err = client.QueryBy(timeout, NewQuery(Mailboxes).NamePrefix("annotated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("expected 1 mailbox, found: %v", len(res))
+	}
+}
+
+func TestQueryWatchSlowWatcher(t *testing.T) {
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	// Watches of the same entities share one etcd watch.
+	client.registry.WatchBuffer = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, fast, err := client.QueryWatch(ctx, Mailboxes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, slow, err := client.QueryWatch(ctx, Mailboxes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fast watcher keeps up, while the slow watcher
+	// reads nothing, so it falls behind and is dropped.
+	for i := 0; i < 5; i++ {
+		mailbox, err := NewMailbox(server, fmt.Sprintf("slow-watch-%v", i), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mailbox.Close()
+		select {
+		case e := <-fast:
+			if e.Type != EntityFound {
+				t.Fatalf("expected mailbox found, got: %v", e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected watch event")
+		}
+	}
+
+	for {
+		select {
+		case e := <-slow:
+			if e.Type != WatchError {
+				continue
+			}
+			if e.Err() != ErrSlowWatcher {
+				t.Fatalf("expected error: %v, got: %v", ErrSlowWatcher, e.Err())
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected slow watcher to be dropped")
+		}
+	}
+}
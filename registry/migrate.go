@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"context"
+	"strings"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+)
+
+// Migration of keys from one prefix of etcd to another, see Migrate.
+type Migration struct {
+	// Moved keys, relative to the prefixes.
+	Moved []string
+	// Skipped keys, relative to the prefixes, which already
+	// existed under the new prefix, or changed while being
+	// moved.
+	Skipped []string
+}
+
+// Migrate the keys starting with keyPrefix from under the prefix from
+// to under the prefix to, in etcd. Keys bound to a lease are moved with
+// the same lease, so registrations still expire with their registry.
+// Keys which already exist under the new prefix are skipped, as are
+// keys which change while being moved. With remove the keys are also
+// deleted from under the old prefix, in the same transaction. With
+// dryRun nothing is written, and the keys which would be moved are
+// reported as moved.
+func Migrate(c context.Context, client *etcdv3.Client, from, to, keyPrefix string, remove, dryRun bool) (*Migration, error) {
+	if client == nil {
+		return nil, ErrNilEtcd
+	}
+	kv := etcdv3.NewKV(client)
+
+	getRes, err := kv.Get(c, from+keyPrefix, etcdv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	m := &Migration{}
+	for _, src := range getRes.Kvs {
+		key := strings.TrimPrefix(string(src.Key), from)
+		dst := to + key
+		if dryRun {
+			dstRes, err := kv.Get(c, dst, etcdv3.WithCountOnly())
+			if err != nil {
+				return m, err
+			}
+			if dstRes.Count > 0 {
+				m.Skipped = append(m.Skipped, key)
+			} else {
+				m.Moved = append(m.Moved, key)
+			}
+			continue
+		}
+
+		var opts []etcdv3.OpOption
+		if src.Lease != 0 {
+			opts = append(opts, etcdv3.WithLease(etcdv3.LeaseID(src.Lease)))
+		}
+		ops := []etcdv3.Op{etcdv3.OpPut(dst, string(src.Value), opts...)}
+		if remove {
+			ops = append(ops, etcdv3.OpDelete(string(src.Key)))
+		}
+		txnRes, err := kv.Txn(c).
+			If(etcdv3.Compare(etcdv3.Version(dst), "=", 0),
+				etcdv3.Compare(etcdv3.ModRevision(string(src.Key)), "=", src.ModRevision)).
+			Then(ops...).
+			Commit()
+		if err != nil {
+			return m, err
+		}
+		if txnRes.Succeeded {
+			m.Moved = append(m.Moved, key)
+		} else {
+			m.Skipped = append(m.Skipped, key)
+		}
+	}
+	return m, nil
+}
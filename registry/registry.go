@@ -6,12 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	etcdv3 "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/namespace"
 )
 
 // Logger hides the logging function Printf behind a simple
@@ -29,11 +33,23 @@ var (
 	ErrAlreadyRegistered           = errors.New("registry: already registered")
 	ErrFailedRegistration          = errors.New("registry: failed registration")
 	ErrFailedDeregistration        = errors.New("registry: failed deregistration")
+	ErrFailedUpdate                = errors.New("registry: failed update")
 	ErrLeaseDurationTooShort       = errors.New("registry: lease duration too short")
 	ErrUnknownNetAddressType       = errors.New("registry: unknown net address type")
 	ErrWatchClosedUnexpectedly     = errors.New("registry: watch closed unexpectedly")
 	ErrUnspecifiedNetAddressIP     = errors.New("registry: unspecified net address ip")
+	ErrInvalidAdvertiseAddress     = errors.New("registry: invalid advertise address")
 	ErrKeepAliveClosedUnexpectedly = errors.New("registry: keep alive closed unexpectedly")
+	ErrSlowSubscriber              = errors.New("registry: slow subscriber")
+)
+
+const (
+	// UnixScheme prefixes the addresses of unix sockets.
+	UnixScheme = "unix://"
+
+	// defaultWatchBuffer of subscribers of a shared watch,
+	// when the registry's WatchBuffer is zero or less.
+	defaultWatchBuffer = 1024
 )
 
 var (
@@ -42,17 +58,50 @@ var (
 
 // Registration information.
 type Registration struct {
-	Key         string   `json:"key"`
-	Address     string   `json:"address"`
-	Registry    string   `json:"registry"`
-	Annotations []string `json:"annotations"`
+	Key         string            `json:"key"`
+	Address     string            `json:"address"`
+	Registry    string            `json:"registry"`
+	Annotations []string          `json:"annotations"`
+	Schemas     map[string]string `json:"schemas,omitempty"`
+	Registered  time.Time         `json:"registered"`
+	Status      string            `json:"status,omitempty"`
+	// Token fencing the registration's owner, which is the
+	// etcd revision that created the key. It increases each
+	// time the key is registered anew, so a stale owner has
+	// a smaller token than the current one. It is not stored
+	// in the registration, but filled in when read.
+	Token int64 `json:"-"`
+	// Revision of etcd which last modified the registration,
+	// it changes with every update, unlike the token. Like the
+	// token, it is filled in when read.
+	Revision int64 `json:"-"`
 }
 
 // String descritpion of registration.
 func (r *Registration) String() string {
-	sort.Strings(r.Annotations)
-	return fmt.Sprintf("key: %v, address: %v, registry: %v, annotations: %v",
-		r.Key, r.Address, r.Registry, strings.Join(r.Annotations, ","))
+	annotations := append([]string{}, r.Annotations...)
+	sort.Strings(annotations)
+	return fmt.Sprintf("key: %v, address: %v, registry: %v, annotations: %v, status: %v",
+		r.Key, r.Address, r.Registry, strings.Join(annotations, ","), r.Status)
+}
+
+// clone of the registration, sharing nothing with it, nil
+// if the registration is nil.
+func (r *Registration) clone() *Registration {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	if r.Annotations != nil {
+		c.Annotations = append([]string{}, r.Annotations...)
+	}
+	if r.Schemas != nil {
+		c.Schemas = make(map[string]string, len(r.Schemas))
+		for k, v := range r.Schemas {
+			c.Schemas[k] = v
+		}
+	}
+	return &c
 }
 
 // EventType of a watch event.
@@ -71,6 +120,9 @@ type WatchEvent struct {
 	Reg   *Registration
 	Type  EventType
 	Error error
+	// value of the event of a watch of a value,
+	// nil for deletes, see WatchValue.
+	value *Value
 }
 
 // String representation of the watch event.
@@ -90,10 +142,19 @@ func (we *WatchEvent) String() string {
 
 // Registry for discovery.
 type Registry struct {
+	// Unix nanoseconds of the last keep alive response,
+	// or of the lease grant. First in the struct so it
+	// is aligned for atomic access on 32-bit platforms.
+	lastKeepAlive int64
 	mu            sync.Mutex
 	done          chan bool
 	exited        chan bool
+	failure       <-chan error
+	owned         map[string]*Registration
+	watches       map[watchKey]*sharedWatch
 	kv            etcdv3.KV
+	watcher       etcdv3.Watcher
+	prefix        string
 	lease         etcdv3.Lease
 	leaseID       etcdv3.LeaseID
 	client        *etcdv3.Client
@@ -102,23 +163,59 @@ type Registry struct {
 	Logger        Logger
 	Timeout       time.Duration
 	LeaseDuration time.Duration
+	// AdvertiseAddress, as host:port or unix://path, under
+	// which the registry's entries are reachable, when it
+	// differs from the address passed to Start, for example
+	// behind NAT or in a container.
+	AdvertiseAddress string
+	// ResumeAttempts of a ResumeWatch, in a row, before
+	// it gives up and reports an error.
+	ResumeAttempts int
+	// WatchBuffer of each subscriber of a shared watch, in
+	// events, see ResumeWatch. Zero or less means the default
+	// of 1024.
+	WatchBuffer int
+	// SlowSubscriberPolicy for subscribers of a shared watch
+	// whose buffer is full, see ResumeWatch.
+	SlowSubscriberPolicy SlowSubscriberPolicy
 	// Testing hook.
 	keepAliveStats *keepAliveStats
 }
 
 // New Registry.
 func New(client *etcdv3.Client) (*Registry, error) {
+	return NewWithPrefix(client, "")
+}
+
+// NewWithPrefix creates a Registry whose keys are all stored under
+// the given prefix in etcd. Keys passed to, and returned by, the
+// registry are relative to the prefix, so the registry behaves the
+// same under any prefix, and etcd's role based access control can
+// restrict it to the prefix.
+func NewWithPrefix(client *etcdv3.Client, prefix string) (*Registry, error) {
 	if client == nil {
 		return nil, ErrNilEtcd
 	}
+	kv := etcdv3.NewKV(client)
+	watcher := client.Watcher
+	if prefix != "" {
+		kv = namespace.NewKV(kv, prefix)
+		watcher = namespace.NewWatcher(watcher, prefix)
+	}
 	return &Registry{
-		done:          make(chan bool),
-		exited:        make(chan bool),
-		kv:            etcdv3.NewKV(client),
-		leaseID:       -1,
-		client:        client,
-		Timeout:       10 * time.Second,
-		LeaseDuration: 60 * time.Second,
+		done:           make(chan bool),
+		exited:         make(chan bool),
+		owned:          map[string]*Registration{},
+		watches:        map[watchKey]*sharedWatch{},
+		kv:             kv,
+		watcher:        watcher,
+		prefix:         prefix,
+		leaseID:        -1,
+		client:         client,
+		Timeout:        10 * time.Second,
+		LeaseDuration:  60 * time.Second,
+		ResumeAttempts: 10,
+		WatchBuffer:    defaultWatchBuffer,
 	}, nil
 }
 
@@ -127,7 +224,13 @@ func (rr *Registry) Start(addr net.Addr) (<-chan error, error) {
 	rr.mu.Lock()
 	defer rr.mu.Unlock()
 
-	address, err := formatAddress(addr)
+	var err error
+	address := rr.AdvertiseAddress
+	if address == "" {
+		address, err = formatAddress(addr)
+	} else {
+		err = checkAdvertiseAddress(address)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -139,6 +242,13 @@ func (rr *Registry) Start(addr net.Addr) (<-chan error, error) {
 	}
 	rr.lease = etcdv3.NewLease(rr.client)
 
+	return rr.grant()
+}
+
+// grant a lease and keep it alive, the returned channel receives
+// an error if the keep alive fails. The registry's lock must be
+// held by the caller.
+func (rr *Registry) grant() (<-chan error, error) {
 	timeout, cancel := context.WithTimeout(context.Background(), rr.Timeout)
 	res, err := rr.lease.Grant(timeout, int64(rr.LeaseDuration.Seconds()))
 	cancel()
@@ -146,6 +256,7 @@ func (rr *Registry) Start(addr net.Addr) (<-chan error, error) {
 		return nil, err
 	}
 	rr.leaseID = res.ID
+	atomic.StoreInt64(&rr.lastKeepAlive, time.Now().UnixNano())
 
 	// Start the keep alive for the lease.
 	keepAliveCtx, keepAliveCancel := context.WithCancel(context.Background())
@@ -162,8 +273,11 @@ func (rr *Registry) Start(addr net.Addr) (<-chan error, error) {
 	//        lease repeatedly, in which case it will cancel
 	//        its context and exit.
 	failure := make(chan error, 1)
+	exited := make(chan bool)
+	rr.exited = exited
+	rr.failure = failure
 	go func() {
-		defer close(rr.exited)
+		defer close(exited)
 
 		// Track stats related to keep alive responses.
 		stats := &keepAliveStats{}
@@ -201,6 +315,7 @@ func (rr *Registry) Start(addr net.Addr) (<-chan error, error) {
 					return
 				}
 				rr.logf("registry: %v: keep alive responded with heartbeat TTL: %vs", rr.name, res.TTL)
+				atomic.StoreInt64(&rr.lastKeepAlive, time.Now().UnixNano())
 				// Testing hook.
 				if stats != nil {
 					stats.success++
@@ -212,11 +327,31 @@ func (rr *Registry) Start(addr net.Addr) (<-chan error, error) {
 	return failure, nil
 }
 
-// Address of this registry in the format of <ip>:<port>
+// KeepAliveAge of the registry's lease, the time since the
+// lease was last kept alive, or granted. An age approaching
+// the lease duration means the lease, and with it every
+// registration, is about to expire. Before Start the age
+// is zero.
+func (rr *Registry) KeepAliveAge() time.Duration {
+	last := atomic.LoadInt64(&rr.lastKeepAlive)
+	if last == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, last))
+}
+
+// Address of this registry in the format of <ip>:<port>, with
+// IPv6 addresses in brackets, or unix://<path> for unix sockets,
+// or the advertise address if one is set.
 func (rr *Registry) Address() string {
 	return rr.address
 }
 
+// Prefix under which the registry's keys are stored in etcd.
+func (rr *Registry) Prefix() string {
+	return rr.prefix
+}
+
 // Registry name, which is a human readable all ASCII
 // transformation of the network address.
 func (rr *Registry) Registry() string {
@@ -235,7 +370,10 @@ func (rr *Registry) Stop() error {
 	close(rr.done)
 	// Wait for those background go-routines
 	// to actually exit.
-	<-rr.exited
+	rr.mu.Lock()
+	exited := rr.exited
+	rr.mu.Unlock()
+	<-exited
 	// Then revoke the lease to cleanly remove
 	// all keys associated with this registry
 	// from etcd.
@@ -261,6 +399,8 @@ func (rr *Registry) Watch(c context.Context, prefix string) ([]*Registration, <-
 		if err != nil {
 			return nil, nil, err
 		}
+		reg.Token = kv.CreateRevision
+		reg.Revision = kv.ModRevision
 		registrations = append(registrations, reg)
 	}
 
@@ -284,33 +424,9 @@ func (rr *Registry) Watch(c context.Context, prefix string) ([]*Registration, <-
 			}
 		}()
 	}
-	// Create a watch-event from an event.
-	createWatchEvent := func(ev *etcdv3.Event) *WatchEvent {
-		wev := &WatchEvent{Key: string(ev.Kv.Key)}
-		reg := &Registration{}
-		if ev.IsCreate() {
-			wev.Type = Create
-		} else if ev.IsModify() {
-			wev.Type = Modify
-		} else {
-			wev.Type = Delete
-			// Need to return now because
-			// delete events don't contain
-			// any data to unmarshal.
-			return wev
-		}
-		err := json.Unmarshal(ev.Kv.Value, reg)
-		if err != nil {
-			wev.Error = fmt.Errorf("%v: failed unmarshaling value: '%s'", err, ev.Kv.Value)
-		} else {
-			wev.Reg = reg
-		}
-		return wev
-	}
-
 	// Watch deltas in etcd, with the give prefix, starting
 	// at the revision of the get call above.
-	deltas := rr.client.Watch(c, prefix, etcdv3.WithPrefix(), etcdv3.WithRev(getRes.Header.Revision+1))
+	deltas := rr.watcher.Watch(c, prefix, etcdv3.WithPrefix(), etcdv3.WithRev(getRes.Header.Revision+1))
 	go func() {
 		for {
 			select {
@@ -330,7 +446,7 @@ func (rr *Registry) Watch(c context.Context, prefix string) ([]*Registration, <-
 					return
 				}
 				for _, event := range delta.Events {
-					put(createWatchEvent(event))
+					put(newWatchEvent(event))
 				}
 			}
 		}
@@ -339,6 +455,32 @@ func (rr *Registry) Watch(c context.Context, prefix string) ([]*Registration, <-
 	return registrations, watchEvents, nil
 }
 
+// newWatchEvent from an etcd event.
+func newWatchEvent(ev *etcdv3.Event) *WatchEvent {
+	wev := &WatchEvent{Key: string(ev.Kv.Key)}
+	reg := &Registration{}
+	if ev.IsCreate() {
+		wev.Type = Create
+	} else if ev.IsModify() {
+		wev.Type = Modify
+	} else {
+		wev.Type = Delete
+		// Need to return now because
+		// delete events don't contain
+		// any data to unmarshal.
+		return wev
+	}
+	err := json.Unmarshal(ev.Kv.Value, reg)
+	if err != nil {
+		wev.Error = fmt.Errorf("%v: failed unmarshaling value: '%s'", err, ev.Kv.Value)
+	} else {
+		reg.Token = ev.Kv.CreateRevision
+		reg.Revision = ev.Kv.ModRevision
+		wev.Reg = reg
+	}
+	return wev
+}
+
 // FindRegistrations associated with the prefix.
 func (rr *Registry) FindRegistrations(c context.Context, prefix string) ([]*Registration, error) {
 	rr.mu.Lock()
@@ -355,6 +497,8 @@ func (rr *Registry) FindRegistrations(c context.Context, prefix string) ([]*Regi
 		if err != nil {
 			return nil, err
 		}
+		reg.Token = kv.CreateRevision
+		reg.Revision = kv.ModRevision
 		registrations = append(registrations, reg)
 	}
 	return registrations, nil
@@ -377,6 +521,8 @@ func (rr *Registry) FindRegistration(c context.Context, key string) (*Registrati
 	if err != nil {
 		return nil, err
 	}
+	reg.Token = getRes.Kvs[0].CreateRevision
+	reg.Revision = getRes.Kvs[0].ModRevision
 	return reg, nil
 }
 
@@ -384,6 +530,13 @@ func (rr *Registry) FindRegistration(c context.Context, key string) (*Registrati
 // once, and registering more than once will return an error.
 // Hence, registration can be used for mutual-exclusion.
 func (rr *Registry) Register(c context.Context, key string, annotations ...string) error {
+	return rr.RegisterWithSchemas(c, key, nil, annotations...)
+}
+
+// RegisterWithSchemas under the given key, just like Register, but
+// the registration also lists the schemas of the message types the
+// registrant can decode, by type name.
+func (rr *Registry) RegisterWithSchemas(c context.Context, key string, schemas map[string]string, annotations ...string) error {
 	sort.Strings(annotations)
 	rr.mu.Lock()
 	defer rr.mu.Unlock()
@@ -402,12 +555,15 @@ func (rr *Registry) Register(c context.Context, key string, annotations ...strin
 		// already registered by another address.
 		return ErrAlreadyRegistered
 	}
-	value, err := json.Marshal(&Registration{
+	reg := &Registration{
 		Key:         key,
 		Address:     rr.address,
 		Registry:    rr.name,
 		Annotations: annotations,
-	})
+		Schemas:     schemas,
+		Registered:  time.Now().UTC(),
+	}
+	value, err := json.Marshal(reg)
 	if err != nil {
 		return err
 	}
@@ -421,6 +577,9 @@ func (rr *Registry) Register(c context.Context, key string, annotations ...strin
 	if !txnRes.Succeeded {
 		return ErrFailedRegistration
 	}
+	reg.Token = txnRes.Header.Revision
+	reg.Revision = txnRes.Header.Revision
+	rr.owned[key] = reg
 	return nil
 }
 
@@ -469,9 +628,218 @@ func (rr *Registry) Deregister(c context.Context, key string) error {
 			return ErrFailedDeregistration
 		}
 	}
+	delete(rr.owned, key)
 	return nil
 }
 
+// Update of a registration, see Registry.Update.
+type Update struct {
+	// Annotations replacing the registration's, unless nil.
+	Annotations []string
+	// Status replacing the registration's, unless empty.
+	Status string
+	// Schemas replacing the registration's, unless nil.
+	Schemas map[string]string
+}
+
+// Update the registration under the given key in place. Only the
+// registry which registered the key can update it, and the
+// registration keeps its lease. Watches of the key see a Modify
+// event.
+func (rr *Registry) Update(c context.Context, key string, u Update) error {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	if rr.leaseID < 0 {
+		return ErrNotStarted
+	}
+
+	getRes, err := rr.kv.Get(c, key, etcdv3.WithLimit(1))
+	if err != nil {
+		return err
+	}
+	if getRes.Count == 0 {
+		return ErrUnknownKey
+	}
+	kv := getRes.Kvs[0]
+	rec := &Registration{}
+	err = json.Unmarshal(kv.Value, rec)
+	if err != nil {
+		return err
+	}
+	if rec.Address != rr.address {
+		return ErrNotOwner
+	}
+
+	if u.Annotations != nil {
+		annotations := append([]string{}, u.Annotations...)
+		sort.Strings(annotations)
+		rec.Annotations = annotations
+	}
+	if u.Status != "" {
+		rec.Status = u.Status
+	}
+	if u.Schemas != nil {
+		rec.Schemas = u.Schemas
+	}
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	txnRes, err := rr.kv.Txn(c).
+		If(etcdv3.Compare(etcdv3.Version(key), "=", kv.Version)).
+		Then(etcdv3.OpPut(key, string(value), etcdv3.WithLease(rr.leaseID))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !txnRes.Succeeded {
+		return ErrFailedUpdate
+	}
+	rec.Token = kv.CreateRevision
+	rec.Revision = txnRes.Header.Revision
+	rr.owned[key] = rec
+	return nil
+}
+
+// Annotate the registration under the given key, replacing its
+// annotations, see Update.
+func (rr *Registry) Annotate(c context.Context, key string, annotations ...string) error {
+	if annotations == nil {
+		annotations = []string{}
+	}
+	return rr.Update(c, key, Update{Annotations: annotations})
+}
+
+// Recover the registry after its keep alive failed, as reported
+// on the channel returned by Start, or by a previous Recover. A
+// new lease is granted and kept alive, and each registration made
+// through the registry is moved to the new lease, or registered
+// again if it expired with the lost lease. Registrations claimed
+// by another registry in the meantime are lost, and returned.
+//
+// If the keep alive has not failed, the lease is kept, and only
+// the registrations are checked. Recover can therefore be called
+// again if it returns an error.
+func (rr *Registry) Recover(c context.Context) ([]*Registration, <-chan error, error) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	if rr.leaseID < 0 {
+		return nil, nil, ErrNotStarted
+	}
+	select {
+	case <-rr.done:
+		return nil, nil, ErrNotStarted
+	default:
+	}
+
+	select {
+	case <-rr.exited:
+		lostLeaseID := rr.leaseID
+		_, err := rr.grant()
+		if err != nil {
+			return nil, nil, err
+		}
+		// The lost lease may not have expired yet, revoke it
+		// once its registrations have moved to the new lease.
+		defer func() {
+			timeout, cancel := context.WithTimeout(context.Background(), rr.Timeout)
+			rr.lease.Revoke(timeout, lostLeaseID)
+			cancel()
+		}()
+		rr.logf("registry: %v: granted new lease after keep alive failure", rr.name)
+	default:
+	}
+
+	var lost []*Registration
+	for _, key := range sortedRegistrationKeys(rr.owned) {
+		reg := rr.owned[key]
+		err := rr.reclaim(c, reg)
+		if err == ErrAlreadyRegistered {
+			rr.logf("registry: %v: registration lost to another registry: %v", rr.name, key)
+			delete(rr.owned, key)
+			lost = append(lost, reg)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return lost, rr.failure, nil
+}
+
+// reclaim the registration under the registry's current lease.
+// The registry's lock must be held by the caller.
+func (rr *Registry) reclaim(c context.Context, reg *Registration) error {
+	value, err := json.Marshal(reg)
+	if err != nil {
+		return err
+	}
+
+	getRes, err := rr.kv.Get(c, reg.Key, etcdv3.WithLimit(1))
+	if err != nil {
+		return err
+	}
+	version := int64(0)
+	if getRes.Count > 0 {
+		kv := getRes.Kvs[0]
+		rec := &Registration{}
+		err = json.Unmarshal(kv.Value, rec)
+		if err != nil {
+			return err
+		}
+		if rec.Address != rr.address {
+			return ErrAlreadyRegistered
+		}
+		if etcdv3.LeaseID(kv.Lease) == rr.leaseID {
+			return nil
+		}
+		version = kv.Version
+	}
+
+	txnRes, err := rr.kv.Txn(c).
+		If(etcdv3.Compare(etcdv3.Version(reg.Key), "=", version)).
+		Then(etcdv3.OpPut(reg.Key, string(value), etcdv3.WithLease(rr.leaseID))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !txnRes.Succeeded {
+		return ErrFailedRegistration
+	}
+	// A key registered anew gets a new token.
+	if version == 0 {
+		reg.Token = txnRes.Header.Revision
+	}
+	reg.Revision = txnRes.Header.Revision
+	return nil
+}
+
+// Token fencing the registration under the given key, made
+// through this registry. False is returned if the registry
+// does not own the key, for example after it was deregistered
+// or lost during Recover.
+func (rr *Registry) Token(key string) (int64, bool) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	reg, ok := rr.owned[key]
+	if !ok {
+		return 0, false
+	}
+	return reg.Token, true
+}
+
+func sortedRegistrationKeys(owned map[string]*Registration) []string {
+	keys := make([]string, 0, len(owned))
+	for key := range owned {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (rr *Registry) logf(format string, v ...interface{}) {
 	if rr.Logger != nil {
 		rr.Logger.Printf(format, v...)
@@ -486,7 +854,24 @@ type keepAliveStats struct {
 // formatName formats the address into a human readable form,
 // removing any special characters.
 func formatName(address string) string {
-	name := address
+	if strings.HasPrefix(address, UnixScheme) {
+		// Socket paths are only unique per host.
+		host, _ := os.Hostname()
+		return sanitizeName("unix-" + host + "-" + strings.TrimPrefix(address, UnixScheme))
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return sanitizeName(address)
+	}
+	// The colons of IPv6 addresses, and the percent sign
+	// of their zones, become underscores, which are never
+	// part of IPv4 addresses, so names stay unambiguous.
+	host = strings.Replace(host, ":", "_", -1)
+	host = strings.Replace(host, "%", "_", -1)
+	return sanitizeName(host + "-" + port)
+}
+
+func sanitizeName(name string) string {
 	name = strings.Replace(name, ":", "-", -1)
 	name = strings.Replace(name, ".", "-", -1)
 	name = strings.Replace(name, "/", "-", -1)
@@ -495,8 +880,9 @@ func formatName(address string) string {
 	return name
 }
 
-// formatAddress as ip:port, since just calling String()
-// on the address can return some funky formatting.
+// formatAddress as ip:port, with IPv6 addresses in brackets,
+// or as unix://path for unix sockets, since just calling
+// String() on the address can return some funky formatting.
 func formatAddress(addr net.Addr) (string, error) {
 	switch addr := addr.(type) {
 	default:
@@ -505,6 +891,32 @@ func formatAddress(addr net.Addr) (string, error) {
 		if addr.IP.IsUnspecified() {
 			return "", ErrUnspecifiedNetAddressIP
 		}
-		return fmt.Sprintf("%v:%v", addr.IP, addr.Port), nil
+		return net.JoinHostPort(addr.IP.String(), strconv.Itoa(addr.Port)), nil
+	case *net.UnixAddr:
+		if addr.Name == "" {
+			return "", ErrUnknownNetAddressType
+		}
+		return UnixScheme + addr.Name, nil
+	}
+}
+
+// checkAdvertiseAddress is either host:port, whose host is not an
+// unspecified ip, or unix://path.
+func checkAdvertiseAddress(address string) error {
+	if strings.HasPrefix(address, UnixScheme) {
+		if len(address) == len(UnixScheme) {
+			return ErrInvalidAdvertiseAddress
+		}
+		return nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" || port == "" {
+		return ErrInvalidAdvertiseAddress
 	}
+	// Like the address of the listener, the address
+	// must be one that others can reach.
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		return ErrUnspecifiedNetAddressIP
+	}
+	return nil
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -206,6 +207,253 @@ func TestFindRegistration(t *testing.T) {
 	}
 }
 
+func TestAnnotate(t *testing.T) {
+	client, r, _ := bootstrap(t, start)
+	defer client.Close()
+	defer r.Stop()
+
+	timeout, cancel := timeoutContext()
+	defer cancel()
+
+	err := r.Annotate(timeout, "test-registration", "draining")
+	if err != ErrUnknownKey {
+		t.Fatalf("expected error: %v, got: %v", ErrUnknownKey, err)
+	}
+
+	err = r.Register(timeout, "test-registration", "role=ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Annotate(timeout, "test-registration", "role=ingest", "draining")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := r.FindRegistration(timeout, "test-registration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reg.Annotations) != 2 || reg.Annotations[0] != "draining" || reg.Annotations[1] != "role=ingest" {
+		t.Fatalf("expected sorted annotations, got: %v", reg.Annotations)
+	}
+	if reg.Address != r.Address() {
+		t.Fatal("wrong address")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	client, r, _ := bootstrap(t, start)
+	defer client.Close()
+	defer r.Stop()
+
+	timeout, cancel := timeoutContext()
+	defer cancel()
+
+	err := r.Register(timeout, "test-registration", "role=ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, watch, err := r.Watch(timeout, "test-registration")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Status only, annotations unchanged.
+	err = r.Update(timeout, "test-registration", Update{Status: "degraded"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-watch:
+		if e.Type != Modify || e.Reg.Status != "degraded" {
+			t.Fatalf("expected modify with status degraded, got: %v", e)
+		}
+		if len(e.Reg.Annotations) != 1 || e.Reg.Annotations[0] != "role=ingest" {
+			t.Fatalf("expected annotations unchanged, got: %v", e.Reg.Annotations)
+		}
+	case <-timeout.Done():
+		t.Fatal("expected watch event")
+	}
+
+	// Annotations only, status unchanged.
+	err = r.Update(timeout, "test-registration", Update{Annotations: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := r.FindRegistration(timeout, "test-registration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.Status != "degraded" || len(reg.Annotations) != 0 {
+		t.Fatalf("expected status degraded and no annotations, got: %v", reg)
+	}
+	if token, _ := r.Token("test-registration"); token != reg.Token {
+		t.Fatalf("expected token unchanged: %v, got: %v", reg.Token, token)
+	}
+
+	// Schemas, under a new revision.
+	err = r.Update(timeout, "test-registration", Update{Schemas: map[string]string{"acme.Msg": "0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := r.FindRegistration(timeout, "test-registration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Schemas["acme.Msg"] != "0" || updated.Status != "degraded" {
+		t.Fatalf("expected schemas updated and status unchanged, got: %v", updated)
+	}
+	if updated.Token != reg.Token || updated.Revision <= reg.Revision {
+		t.Fatalf("expected same token and newer revision than: %v, got: %v", reg, updated)
+	}
+
+	// Only the owner can update.
+	other, err := New(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.address = "other:7777"
+	other.leaseID = r.leaseID
+	err = other.Update(timeout, "test-registration", Update{Status: "ready"})
+	if err != ErrNotOwner {
+		t.Fatalf("expected error: %v, got: %v", ErrNotOwner, err)
+	}
+}
+
+func TestNewWithPrefix(t *testing.T) {
+	client, _, addr := bootstrap(t, dontStart)
+	defer client.Close()
+
+	r, err := NewWithPrefix(client, "/test-prefix/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.LeaseDuration = 10 * time.Second
+	_, err = r.Start(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	timeout, cancel := timeoutContext()
+	defer cancel()
+
+	err = r.Register(timeout, "test-registration")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys are relative to the prefix in the registry's API.
+	reg, err := r.FindRegistration(timeout, "test-registration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.Key != "test-registration" {
+		t.Fatalf("expected relative key, got: %v", reg.Key)
+	}
+
+	// And stored under the prefix in etcd.
+	getRes, err := client.Get(timeout, "/test-prefix/test-registration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getRes.Count != 1 {
+		t.Fatal("expected registration under the prefix")
+	}
+	getRes, err = client.Get(timeout, "test-registration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getRes.Count != 0 {
+		t.Fatal("expected no registration outside the prefix")
+	}
+
+	m, err := Migrate(timeout, client, "/test-prefix/", "/test-other/", "test-", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Moved) != 1 || m.Moved[0] != "test-registration" {
+		t.Fatalf("expected registration moved, got: %v", m.Moved)
+	}
+	getRes, err = client.Get(timeout, "/test-other/test-registration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getRes.Count != 1 || getRes.Kvs[0].Lease != int64(r.leaseID) {
+		t.Fatal("expected registration moved with its lease")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	client, r, addr := bootstrap(t, dontStart)
+	defer client.Close()
+
+	failure, err := r.Start(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	timeout, cancel := timeoutContext()
+	defer cancel()
+	for _, key := range []string{"test-registration-a", "test-registration-b"} {
+		err = r.Register(timeout, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Lose the lease, and with it the registrations.
+	lostLeaseID := r.leaseID
+	_, err = client.Revoke(timeout, lostLeaseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-failure:
+		if err != ErrKeepAliveClosedUnexpectedly {
+			t.Fatalf("expected error: %v, got: %v", ErrKeepAliveClosedUnexpectedly, err)
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatal("expected keep alive failure")
+	}
+
+	// Another registry claims one of the names.
+	other, err := New(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.LeaseDuration = r.LeaseDuration
+	_, err = other.Start(&net.TCPAddr{IP: addr.IP, Port: addr.Port + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop()
+	err = other.Register(timeout, "test-registration-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lost, _, err := r.Recover(timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lost) != 1 || lost[0].Key != "test-registration-b" {
+		t.Fatalf("expected lost registration: test-registration-b, got: %v", lost)
+	}
+	if r.leaseID == lostLeaseID {
+		t.Fatal("expected new lease")
+	}
+
+	res, err := client.Get(timeout, "test-registration-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Kvs) != 1 || etcdv3.LeaseID(res.Kvs[0].Lease) != r.leaseID {
+		t.Fatal("expected registration under new lease")
+	}
+}
+
 func TestFindRegistrations(t *testing.T) {
 	client, r, _ := bootstrap(t, start)
 	defer client.Close()
@@ -414,6 +662,16 @@ func TestWatchEventString(t *testing.T) {
 	}
 }
 
+func TestRegistrationString(t *testing.T) {
+	reg := &Registration{Key: "foo", Annotations: []string{"b", "a"}}
+	if !strings.Contains(reg.String(), "annotations: a,b") {
+		t.Fatalf("expected sorted annotations, got: %v", reg)
+	}
+	if reg.Annotations[0] != "b" {
+		t.Fatalf("expected annotations unchanged, got: %v", reg.Annotations)
+	}
+}
+
 func bootstrap(t *testing.T, shouldStart bool) (*etcdv3.Client, *Registry, *net.TCPAddr) {
 	client := testetcd.StartAndConnect(t)
 
@@ -441,3 +699,85 @@ func bootstrap(t *testing.T, shouldStart bool) (*etcdv3.Client, *Registry, *net.
 func timeoutContext() (context.Context, func()) {
 	return context.WithTimeout(context.Background(), 2*time.Second)
 }
+
+func TestKeepAliveAge(t *testing.T) {
+	client, r, addr := bootstrap(t, dontStart)
+	defer client.Close()
+
+	if r.KeepAliveAge() != 0 {
+		t.Fatal("expected zero keep alive age before start")
+	}
+	_, err := r.Start(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	if age := r.KeepAliveAge(); age <= 0 || age > r.LeaseDuration {
+		t.Fatalf("expected keep alive age within lease duration, got: %v", age)
+	}
+}
+
+func TestFormatAddress(t *testing.T) {
+	cases := []struct {
+		addr     net.Addr
+		expected string
+		err      error
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 7777}, "10.0.0.1:7777", nil},
+		{&net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 7777}, "[fe80::1]:7777", nil},
+		{&net.TCPAddr{IP: net.IPv6unspecified, Port: 7777}, "", ErrUnspecifiedNetAddressIP},
+		{&net.UnixAddr{Name: "/tmp/grid.sock", Net: "unix"}, "unix:///tmp/grid.sock", nil},
+		{&net.IPAddr{IP: net.ParseIP("10.0.0.1")}, "", ErrUnknownNetAddressType},
+	}
+	for _, c := range cases {
+		address, err := formatAddress(c.addr)
+		if err != c.err {
+			t.Fatalf("expected error: %v, for: %v, got: %v", c.err, c.addr, err)
+		}
+		if address != c.expected {
+			t.Fatalf("expected address: %v, got: %v", c.expected, address)
+		}
+	}
+}
+
+func TestFormatName(t *testing.T) {
+	cases := map[string]string{
+		"10.0.0.1:7777":           "10-0-0-1-7777",
+		"[fe80::1]:7777":          "fe80__1-7777",
+		"[::1]:7777":              "__1-7777",
+		"[fe80::1%eth0]:7777":     "fe80__1_eth0-7777",
+		"node-1.example.com:7777": "node-1-example-com-7777",
+	}
+	for address, expected := range cases {
+		if name := formatName(address); name != expected {
+			t.Fatalf("expected name: %v, for: %v, got: %v", expected, address, name)
+		}
+	}
+
+	host, _ := os.Hostname()
+	if name := formatName("unix:///tmp/grid.sock"); !strings.Contains(name, "tmp-grid-sock") || !strings.HasPrefix(name, "unix-"+host) {
+		t.Fatalf("expected unix socket name with host and path, got: %v", name)
+	}
+}
+
+func TestCheckAdvertiseAddress(t *testing.T) {
+	valid := []string{"10.0.0.1:7777", "[::1]:7777", "grid.example.com:7777", "unix:///tmp/grid.sock"}
+	for _, address := range valid {
+		if err := checkAdvertiseAddress(address); err != nil {
+			t.Fatalf("expected valid advertise address: %v", address)
+		}
+	}
+	invalid := []string{"10.0.0.1", ":7777", "unix://", "::1:7777"}
+	for _, address := range invalid {
+		if err := checkAdvertiseAddress(address); err != ErrInvalidAdvertiseAddress {
+			t.Fatalf("expected invalid advertise address: %v", address)
+		}
+	}
+	unspecified := []string{"0.0.0.0:7777", "[::]:7777"}
+	for _, address := range unspecified {
+		if err := checkAdvertiseAddress(address); err != ErrUnspecifiedNetAddressIP {
+			t.Fatalf("expected unspecified advertise address: %v", address)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+)
+
+// entry of a resumable watch's view of the registry, a
+// registration or, for watches of values, a value.
+type entry struct {
+	reg    *Registration
+	value  *Value
+	modRev int64
+}
+
+// clone of the entry, sharing nothing with it.
+func (e *entry) clone() *entry {
+	return &entry{reg: e.reg.clone(), value: e.value.clone(), modRev: e.modRev}
+}
+
+// ResumeWatch a prefix in the registry. It behaves like Watch,
+// but when the underlying etcd watch closes or errors, the watch
+// is resumed from the last revision seen. If that revision has
+// been compacted, the prefix is listed again and the difference
+// from the last known state is sent as synthetic create, modify,
+// and delete events. Delete events carry the last registration
+// seen for the key. An error is only sent, and the channel closed,
+// after ResumeAttempts attempts in a row fail to resume.
+//
+// Resumable watches of the same prefix share one etcd watch. Each
+// watcher has a buffer of WatchBuffer events, and a watcher whose
+// buffer is full is dealt with according to SlowSubscriberPolicy,
+// so by default one stuck watcher does not hold up the others.
+// Watches of different prefixes are not shared, even if one prefix
+// contains the other.
+func (rr *Registry) ResumeWatch(c context.Context, prefix string) ([]*Registration, <-chan *WatchEvent, error) {
+	entries, watchEvents, err := rr.subscribe(c, registrationWatch, prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	registrations := make([]*Registration, 0, len(entries))
+	for _, e := range entries {
+		registrations = append(registrations, e.reg)
+	}
+	return registrations, watchEvents, nil
+}
+
+// list the registrations under the prefix, by key, and
+// the revision of the listing.
+func (rr *Registry) list(c context.Context, prefix string) (map[string]*entry, int64, error) {
+	getRes, err := rr.kv.Get(c, prefix, etcdv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	state := make(map[string]*entry, len(getRes.Kvs))
+	for _, kv := range getRes.Kvs {
+		reg := &Registration{}
+		err = json.Unmarshal(kv.Value, reg)
+		if err != nil {
+			return nil, 0, err
+		}
+		reg.Token = kv.CreateRevision
+		reg.Revision = kv.ModRevision
+		state[string(kv.Key)] = &entry{reg: reg, modRev: kv.ModRevision}
+	}
+	return state, getRes.Header.Revision, nil
+}
+
+// diffEntries returns the events which turn the previous
+// state into the latest state, sorted by key.
+func diffEntries(previous, latest map[string]*entry) []*WatchEvent {
+	keys := sortedKeys(previous)
+	for key := range latest {
+		if _, ok := previous[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var events []*WatchEvent
+	for _, key := range keys {
+		p, inPrevious := previous[key]
+		l, inLatest := latest[key]
+		switch {
+		case inPrevious && !inLatest:
+			events = append(events, &WatchEvent{Key: key, Reg: p.reg, Type: Delete})
+		case !inPrevious && inLatest:
+			events = append(events, &WatchEvent{Key: key, Reg: l.reg, Type: Create, value: l.value})
+		case p.modRev != l.modRev:
+			events = append(events, &WatchEvent{Key: key, Reg: l.reg, Type: Modify, value: l.value})
+		}
+	}
+	return events
+}
+
+func sortedKeys(state map[string]*entry) []string {
+	keys := make([]string, 0, len(state))
+	for key := range state {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
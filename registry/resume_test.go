@@ -0,0 +1,121 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDiffEntries(t *testing.T) {
+	previous := map[string]*entry{
+		"peer-1": {reg: &Registration{Key: "peer-1"}, modRev: 1},
+		"peer-2": {reg: &Registration{Key: "peer-2"}, modRev: 2},
+		"peer-3": {reg: &Registration{Key: "peer-3"}, modRev: 3},
+	}
+	latest := map[string]*entry{
+		"peer-2": {reg: &Registration{Key: "peer-2"}, modRev: 2},
+		"peer-3": {reg: &Registration{Key: "peer-3"}, modRev: 5},
+		"peer-4": {reg: &Registration{Key: "peer-4"}, modRev: 4},
+	}
+
+	expected := []struct {
+		key string
+		typ EventType
+	}{
+		{"peer-1", Delete},
+		{"peer-3", Modify},
+		{"peer-4", Create},
+	}
+
+	events := diffEntries(previous, latest)
+	if len(events) != len(expected) {
+		t.Fatalf("expected %v events, got: %v", len(expected), len(events))
+	}
+	for i, e := range expected {
+		if events[i].Key != e.key || events[i].Type != e.typ {
+			t.Fatalf("expected event: %v, got: %v", e, events[i])
+		}
+		if events[i].Reg == nil || events[i].Reg.Key != e.key {
+			t.Fatalf("expected registration for: %v", e.key)
+		}
+	}
+}
+
+func TestResumeWatchAfterCompaction(t *testing.T) {
+	client, r, _ := bootstrap(t, start)
+	defer client.Close()
+	defer r.Stop()
+
+	timeout, cancel := timeoutContext()
+	err := r.Register(timeout, "resume-peer-1")
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Take the state, then change the registry
+	// and compact away the revisions in between.
+	timeout, cancel = timeoutContext()
+	state, rev, err := r.list(timeout, "resume-peer")
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state) != 1 {
+		t.Fatalf("expected 1 registration, got: %v", len(state))
+	}
+
+	timeout, cancel = timeoutContext()
+	err = r.Register(timeout, "resume-peer-2")
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout, cancel = timeoutContext()
+	err = r.Deregister(timeout, "resume-peer-1")
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout, cancel = timeoutContext()
+	latest, _, err := r.list(timeout, "resume-peer")
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout, cancel = timeoutContext()
+	_, err = r.kv.Compact(timeout, latest["resume-peer-2"].modRev)
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resuming from the stale revision must produce
+	// the difference as synthetic events.
+	ctx, cancelWatch := context.WithCancel(context.Background())
+	defer cancelWatch()
+	sw := newSharedWatch(r, registrationWatch, "resume-peer", state, rev)
+	defer sw.cancel()
+	_, events := sw.add(ctx)
+	go sw.run()
+
+	expected := map[string]EventType{
+		"resume-peer-1": Delete,
+		"resume-peer-2": Create,
+	}
+	for len(expected) > 0 {
+		select {
+		case e := <-events:
+			if e.Error != nil {
+				t.Fatal(e.Error)
+			}
+			typ, ok := expected[e.Key]
+			if !ok || typ != e.Type {
+				t.Fatalf("unexpected event: %v", e)
+			}
+			delete(expected, e.Key)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("expected events: %v", expected)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+)
+
+var (
+	ErrNoPermits      = errors.New("registry: no permits available")
+	ErrInvalidPermits = errors.New("registry: invalid number of permits")
+	ErrInvalidTTL     = errors.New("registry: invalid ttl")
+)
+
+// Permit of a semaphore in the registry, held until released or
+// until its lease is lost. A lock is a semaphore of one permit.
+type Permit struct {
+	// Key of the permit's registration, under the semaphore's prefix.
+	Key string
+	// Token fencing the holder of the permit, see Registration.Token.
+	Token int64
+
+	rr      *Registry
+	leaseID etcdv3.LeaseID
+	cancel  func()
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Done is closed when the permit is released, or lost because
+// its lease could not be kept alive.
+func (p *Permit) Done() <-chan struct{} {
+	return p.done
+}
+
+// Release the permit, by revoking its lease.
+func (p *Permit) Release(c context.Context) error {
+	p.cancel()
+	p.once.Do(func() { close(p.done) })
+	_, err := p.rr.client.Revoke(c, p.leaseID)
+	return err
+}
+
+// Acquire one of the permits of the semaphore under the prefix,
+// waiting until one is available or the context is done. Each
+// holder registers a key under the prefix, bound to a lease of
+// the given time to live which is kept alive until the permit
+// is released. The holders of the permits are the first holders
+// by registration, so waiting holders are served in order. Every
+// user of the semaphore must use the same number of permits.
+func (rr *Registry) Acquire(c context.Context, prefix string, permits int, ttl time.Duration) (*Permit, error) {
+	return rr.acquire(c, prefix, permits, ttl, true)
+}
+
+// TryAcquire one of the permits of the semaphore under the prefix,
+// like Acquire, but return ErrNoPermits instead of waiting if none
+// is available.
+func (rr *Registry) TryAcquire(c context.Context, prefix string, permits int, ttl time.Duration) (*Permit, error) {
+	return rr.acquire(c, prefix, permits, ttl, false)
+}
+
+func (rr *Registry) acquire(c context.Context, prefix string, permits int, ttl time.Duration, wait bool) (*Permit, error) {
+	if permits < 1 {
+		return nil, ErrInvalidPermits
+	}
+	if ttl < time.Second {
+		return nil, ErrInvalidTTL
+	}
+
+	grantRes, err := rr.client.Grant(c, int64(ttl.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%v%x", prefix, int64(grantRes.ID))
+	value, err := json.Marshal(&Registration{
+		Key:        key,
+		Address:    rr.address,
+		Registry:   rr.name,
+		Registered: time.Now().UTC(),
+	})
+	if err != nil {
+		rr.revoke(grantRes.ID)
+		return nil, err
+	}
+	txnRes, err := rr.kv.Txn(c).
+		If(etcdv3.Compare(etcdv3.Version(key), "=", 0)).
+		Then(etcdv3.OpPut(key, string(value), etcdv3.WithLease(grantRes.ID))).
+		Commit()
+	if err != nil {
+		rr.revoke(grantRes.ID)
+		return nil, err
+	}
+	if !txnRes.Succeeded {
+		rr.revoke(grantRes.ID)
+		return nil, ErrFailedRegistration
+	}
+
+	keepAliveCtx, keepAliveCancel := context.WithCancel(context.Background())
+	keepAlive, err := rr.client.KeepAlive(keepAliveCtx, grantRes.ID)
+	if err != nil {
+		keepAliveCancel()
+		rr.revoke(grantRes.ID)
+		return nil, err
+	}
+	p := &Permit{
+		Key:     key,
+		Token:   txnRes.Header.Revision,
+		rr:      rr,
+		leaseID: grantRes.ID,
+		cancel:  keepAliveCancel,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		for range keepAlive {
+		}
+		p.once.Do(func() { close(p.done) })
+	}()
+
+	for {
+		getRes, err := rr.kv.Get(c, prefix, etcdv3.WithPrefix())
+		if err != nil {
+			rr.release(p)
+			return nil, err
+		}
+		holders := getRes.Kvs
+		sort.Slice(holders, func(i, j int) bool {
+			return holders[i].CreateRevision < holders[j].CreateRevision
+		})
+		for i := 0; i < len(holders) && i < permits; i++ {
+			if string(holders[i].Key) == key {
+				return p, nil
+			}
+		}
+		if !wait {
+			rr.release(p)
+			return nil, ErrNoPermits
+		}
+
+		// Wait for some holder to leave, then check again.
+		watchC, cancel := context.WithCancel(c)
+		deltas := rr.watcher.Watch(watchC, prefix, etcdv3.WithPrefix(), etcdv3.WithRev(getRes.Header.Revision+1))
+		released := false
+		for delta := range deltas {
+			for _, event := range delta.Events {
+				if event.Type == etcdv3.EventTypeDelete {
+					released = true
+				}
+			}
+			if released || delta.Err() != nil {
+				break
+			}
+		}
+		cancel()
+		select {
+		case <-c.Done():
+			rr.release(p)
+			return nil, c.Err()
+		case <-p.done:
+			rr.release(p)
+			return nil, ErrKeepAliveClosedUnexpectedly
+		default:
+		}
+	}
+}
+
+// release the permit with a context of its own, since
+// the context used to acquire it may be done.
+func (rr *Registry) release(p *Permit) {
+	timeout, cancel := context.WithTimeout(context.Background(), rr.Timeout)
+	defer cancel()
+	p.Release(timeout)
+}
+
+func (rr *Registry) revoke(leaseID etcdv3.LeaseID) {
+	timeout, cancel := context.WithTimeout(context.Background(), rr.Timeout)
+	defer cancel()
+	rr.client.Revoke(timeout, leaseID)
+}
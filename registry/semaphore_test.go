@@ -0,0 +1,90 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAcquireRelease(t *testing.T) {
+	client, r, _ := bootstrap(t, start)
+	defer client.Close()
+	defer r.Stop()
+
+	const ttl = 5 * time.Second
+
+	timeout, cancel := timeoutContext()
+	defer cancel()
+
+	first, err := r.TryAcquire(timeout, "test-semaphore.", 2, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := r.TryAcquire(timeout, "test-semaphore.", 2, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Token <= first.Token {
+		t.Fatal("expected increasing tokens")
+	}
+	_, err = r.TryAcquire(timeout, "test-semaphore.", 2, ttl)
+	if err != ErrNoPermits {
+		t.Fatalf("expected error: %v, got: %v", ErrNoPermits, err)
+	}
+
+	// A waiting acquire gets the permit once one is released.
+	acquired := make(chan *Permit, 1)
+	go func() {
+		waitC, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		p, err := r.Acquire(waitC, "test-semaphore.", 2, ttl)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- p
+	}()
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case <-acquired:
+		t.Fatal("expected acquire to wait")
+	default:
+	}
+
+	err = first.Release(timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-first.Done():
+	default:
+		t.Fatal("expected released permit to be done")
+	}
+	select {
+	case p := <-acquired:
+		if p == nil {
+			t.Fatal("expected permit")
+		}
+		p.Release(timeout)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout")
+	}
+	second.Release(timeout)
+}
+
+func TestAcquireInvalid(t *testing.T) {
+	client, r, _ := bootstrap(t, start)
+	defer client.Close()
+	defer r.Stop()
+
+	timeout, cancel := timeoutContext()
+	defer cancel()
+
+	_, err := r.TryAcquire(timeout, "test-semaphore.", 0, time.Second)
+	if err != ErrInvalidPermits {
+		t.Fatalf("expected error: %v, got: %v", ErrInvalidPermits, err)
+	}
+	_, err = r.TryAcquire(timeout, "test-semaphore.", 1, time.Millisecond)
+	if err != ErrInvalidTTL {
+		t.Fatalf("expected error: %v, got: %v", ErrInvalidTTL, err)
+	}
+}
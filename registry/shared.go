@@ -0,0 +1,406 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+)
+
+// SlowSubscriberPolicy of the registry, for subscribers of a shared
+// watch whose buffer is full when an event arrives, see ResumeWatch.
+type SlowSubscriberPolicy int
+
+const (
+	// DisconnectSlowSubscriber sends the subscriber, after the events
+	// already buffered, the error ErrSlowSubscriber, and closes its
+	// channel. The other subscribers of the watch are unaffected.
+	DisconnectSlowSubscriber SlowSubscriberPolicy = 0
+	// BlockOnSlowSubscriber waits for room in the subscriber's buffer,
+	// which holds up the shared watch and every other subscriber of it.
+	BlockOnSlowSubscriber SlowSubscriberPolicy = 1
+)
+
+// watchKind of a shared watch, what it watches.
+type watchKind int
+
+const (
+	// registrationWatch of the registrations under a prefix.
+	registrationWatch watchKind = 0
+	// valueWatch of the value under a key.
+	valueWatch watchKind = 1
+)
+
+// watchKey of a shared watch in the registry's watches.
+type watchKey struct {
+	kind watchKind
+	key  string
+}
+
+// sharedWatch of a prefix, or of a value's key, one etcd watch
+// multiplexed to the subscribers of every ResumeWatch of the
+// prefix, or of every WatchValue of the key.
+type sharedWatch struct {
+	rr     *Registry
+	kind   watchKind
+	prefix string
+	c      context.Context
+	cancel func()
+
+	mu    sync.Mutex
+	cond  *sync.Cond
+	state map[string]*entry
+	rev   int64
+	subs  map[*subscriber]bool
+}
+
+// subscriber of a shared watch, with the events buffered for it.
+type subscriber struct {
+	queue []*WatchEvent
+	ready chan struct{}
+	// closed once the last event for the subscriber,
+	// an error, has been queued.
+	closed bool
+	// gone once the subscriber has unsubscribed.
+	gone bool
+}
+
+// subscribe to the shared watch of the kind and prefix, starting one
+// if there is none, and return the current entries, sorted by key,
+// and the subscriber's channel. The channel is closed once the
+// context is done.
+func (rr *Registry) subscribe(c context.Context, kind watchKind, prefix string) ([]*entry, <-chan *WatchEvent, error) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	wk := watchKey{kind: kind, key: prefix}
+	sw, ok := rr.watches[wk]
+	if !ok {
+		sw = newSharedWatch(rr, kind, prefix, nil, 0)
+		state, rev, err := sw.list(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		sw.state, sw.rev = state, rev
+		rr.watches[wk] = sw
+		go sw.run()
+	}
+	entries, watchEvents := sw.add(c)
+	return entries, watchEvents, nil
+}
+
+// newSharedWatch of the kind and prefix, given the state of the
+// prefix at revision rev, which watches from the next revision
+// once run.
+func newSharedWatch(rr *Registry, kind watchKind, prefix string, state map[string]*entry, rev int64) *sharedWatch {
+	c, cancel := context.WithCancel(context.Background())
+	sw := &sharedWatch{
+		rr:     rr,
+		kind:   kind,
+		prefix: prefix,
+		c:      c,
+		cancel: cancel,
+		state:  state,
+		rev:    rev,
+		subs:   map[*subscriber]bool{},
+	}
+	sw.cond = sync.NewCond(&sw.mu)
+	return sw
+}
+
+// list the current state of what the watch watches, and the
+// revision of the listing.
+func (sw *sharedWatch) list(c context.Context) (map[string]*entry, int64, error) {
+	if sw.kind == valueWatch {
+		return sw.rr.listValue(c, sw.prefix)
+	}
+	return sw.rr.list(c, sw.prefix)
+}
+
+// decode an event of the watch's etcd watch.
+func (sw *sharedWatch) decode(ev *etcdv3.Event) *WatchEvent {
+	if sw.kind == valueWatch {
+		return newValueWatchEvent(ev)
+	}
+	return newWatchEvent(ev)
+}
+
+// add a subscriber, returning the current entries, sorted
+// by key, and the subscriber's channel.
+func (sw *sharedWatch) add(c context.Context) ([]*entry, <-chan *WatchEvent) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	// Each subscriber gets its own copies, so that
+	// none sees what another does to them.
+	entries := make([]*entry, 0, len(sw.state))
+	for _, key := range sortedKeys(sw.state) {
+		entries = append(entries, sw.state[key].clone())
+	}
+	sub := &subscriber{ready: make(chan struct{}, 1)}
+	sw.subs[sub] = true
+
+	watchEvents := make(chan *WatchEvent)
+	go sw.deliver(c, sub, watchEvents)
+
+	return entries, watchEvents
+}
+
+// unsubscribe from the shared watch, which is stopped once
+// it has no subscribers left.
+func (sw *sharedWatch) unsubscribe(sub *subscriber) {
+	rr := sw.rr
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sub.gone = true
+	delete(sw.subs, sub)
+	sw.cond.Broadcast()
+	if len(sw.subs) == 0 {
+		sw.remove()
+		sw.cancel()
+	}
+}
+
+// deliver the events queued for the subscriber on its channel,
+// until the context is done or the subscriber is closed.
+func (sw *sharedWatch) deliver(c context.Context, sub *subscriber, watchEvents chan *WatchEvent) {
+	defer close(watchEvents)
+	defer sw.unsubscribe(sub)
+
+	for {
+		sw.mu.Lock()
+		if len(sub.queue) == 0 {
+			closed := sub.closed
+			sw.mu.Unlock()
+			if closed {
+				return
+			}
+			select {
+			case <-c.Done():
+				return
+			case <-sub.ready:
+			}
+			continue
+		}
+		we := sub.queue[0]
+		sub.queue[0] = nil
+		sub.queue = sub.queue[1:]
+		sw.cond.Broadcast()
+		sw.mu.Unlock()
+
+		if we.Error != nil {
+			// Like the errors of unshared watches, the error
+			// is delivered even if the context is done, but
+			// not waited on forever.
+			select {
+			case <-time.After(10 * time.Minute):
+			case watchEvents <- we:
+			}
+			return
+		}
+		select {
+		case <-c.Done():
+			return
+		case watchEvents <- we:
+		}
+	}
+}
+
+// publish the event to every subscriber, each getting its own
+// copy of the event, with the shared watch's lock held.
+func (sw *sharedWatch) publish(we *WatchEvent) {
+	subs := make([]*subscriber, 0, len(sw.subs))
+	for sub := range sw.subs {
+		subs = append(subs, sub)
+	}
+	for _, sub := range subs {
+		sw.push(sub, &WatchEvent{Key: we.Key, Reg: we.Reg.clone(), Type: we.Type, Error: we.Error, value: we.value.clone()})
+	}
+}
+
+// push the event onto the subscriber's queue, applying the
+// registry's slow subscriber policy if the queue is full.
+func (sw *sharedWatch) push(sub *subscriber, we *WatchEvent) {
+	rr := sw.rr
+	buffer := rr.WatchBuffer
+	if buffer <= 0 {
+		buffer = defaultWatchBuffer
+	}
+	for !sub.closed && !sub.gone && len(sub.queue) >= buffer {
+		if rr.SlowSubscriberPolicy == BlockOnSlowSubscriber {
+			sw.cond.Wait()
+			continue
+		}
+		rr.logf("registry: %v: watch of prefix: %v, disconnecting slow subscriber", rr.name, sw.prefix)
+		we = &WatchEvent{Error: ErrSlowSubscriber}
+		break
+	}
+	if sub.closed || sub.gone {
+		return
+	}
+	sub.queue = append(sub.queue, we)
+	if we.Error != nil {
+		sub.closed = true
+	}
+	select {
+	case sub.ready <- struct{}{}:
+	default:
+	}
+}
+
+// apply the event to the watch's state, and publish it.
+func (sw *sharedWatch) apply(we *WatchEvent, modRev int64) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if we.Type == Delete {
+		if e, ok := sw.state[we.Key]; ok {
+			we.Reg = e.reg
+		}
+		delete(sw.state, we.Key)
+	} else {
+		sw.state[we.Key] = &entry{reg: we.Reg, value: we.value, modRev: modRev}
+	}
+	sw.publish(we)
+}
+
+// resync the watch's state to the latest listing, publishing
+// the difference as synthetic events.
+func (sw *sharedWatch) resync(latest map[string]*entry, latestRev int64) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	events := diffEntries(sw.state, latest)
+	sw.state, sw.rev = latest, latestRev
+	for _, we := range events {
+		sw.publish(we)
+	}
+}
+
+// fail the watch, sending the error to every subscriber. New
+// subscribers of the prefix start a new shared watch.
+func (sw *sharedWatch) fail(err error) {
+	rr := sw.rr
+	rr.mu.Lock()
+	sw.remove()
+	rr.mu.Unlock()
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	for sub := range sw.subs {
+		if sub.closed {
+			continue
+		}
+		sub.queue = append(sub.queue, &WatchEvent{Error: err})
+		sub.closed = true
+		select {
+		case sub.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// remove the watch from the registry's watches, unless it has
+// been replaced, must be called with the registry's lock held.
+func (sw *sharedWatch) remove() {
+	wk := watchKey{kind: sw.kind, key: sw.prefix}
+	if sw.rr.watches[wk] == sw {
+		delete(sw.rr.watches, wk)
+	}
+}
+
+// run the etcd watch of the prefix, resuming it after errors,
+// until the context is done or resumption fails too many times
+// in a row.
+func (sw *sharedWatch) run() {
+	rr := sw.rr
+	c := sw.c
+
+	failures := 0
+	for {
+		var lastErr error
+		compacted := false
+
+		sw.mu.Lock()
+		rev := sw.rev
+		sw.mu.Unlock()
+
+		opts := []etcdv3.OpOption{etcdv3.WithRev(rev + 1)}
+		if sw.kind == registrationWatch {
+			opts = append(opts, etcdv3.WithPrefix())
+		}
+		watchC, cancel := context.WithCancel(c)
+		deltas := rr.watcher.Watch(watchC, sw.prefix, opts...)
+		for delta := range deltas {
+			if delta.CompactRevision != 0 {
+				compacted = true
+				break
+			}
+			if delta.Err() != nil {
+				lastErr = delta.Err()
+				break
+			}
+			failures = 0
+			for _, event := range delta.Events {
+				we := sw.decode(event)
+				if we.Error != nil {
+					cancel()
+					sw.fail(we.Error)
+					return
+				}
+				sw.apply(we, event.Kv.ModRevision)
+			}
+			sw.mu.Lock()
+			if delta.Header.Revision > sw.rev {
+				sw.rev = delta.Header.Revision
+			}
+			rev = sw.rev
+			sw.mu.Unlock()
+		}
+		cancel()
+
+		select {
+		case <-c.Done():
+			return
+		default:
+		}
+
+		if compacted {
+			rr.logf("registry: %v: watch of prefix: %v, compacted past revision: %v, listing again", rr.name, sw.prefix, rev)
+			timeout, cancel := context.WithTimeout(c, rr.Timeout)
+			latest, latestRev, err := sw.list(timeout)
+			cancel()
+			if err == nil {
+				sw.resync(latest, latestRev)
+				failures = 0
+				continue
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = ErrWatchClosedUnexpectedly
+		}
+
+		failures++
+		if failures >= rr.ResumeAttempts {
+			sw.fail(lastErr)
+			return
+		}
+		rr.logf("registry: %v: watch of prefix: %v, resuming after error: %v", rr.name, sw.prefix, lastErr)
+
+		// Back off linearly, up to the registry's timeout.
+		backoff := time.Duration(failures) * time.Second
+		if backoff > rr.Timeout {
+			backoff = rr.Timeout
+		}
+		select {
+		case <-c.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
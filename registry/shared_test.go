@@ -0,0 +1,309 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestSharedWatch which is not run, events are applied
+// to it directly.
+func newTestSharedWatch(buffer int, policy SlowSubscriberPolicy) *sharedWatch {
+	rr := &Registry{
+		watches:              map[watchKey]*sharedWatch{},
+		WatchBuffer:          buffer,
+		SlowSubscriberPolicy: policy,
+	}
+	return newSharedWatch(rr, registrationWatch, "peer", map[string]*entry{}, 0)
+}
+
+func applyCreate(sw *sharedWatch, i int) {
+	key := fmt.Sprintf("peer-%v", i)
+	sw.apply(&WatchEvent{Key: key, Type: Create, Reg: &Registration{Key: key}}, int64(i))
+}
+
+func TestSharedWatchSnapshot(t *testing.T) {
+	sw := newTestSharedWatch(10, DisconnectSlowSubscriber)
+	defer sw.cancel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	applyCreate(sw, 1)
+	current, events := sw.add(ctx)
+	if len(current) != 1 || current[0].reg.Key != "peer-1" {
+		t.Fatalf("expected current registration peer-1, got: %v", current)
+	}
+
+	applyCreate(sw, 2)
+	sw.apply(&WatchEvent{Key: "peer-1", Type: Delete}, 3)
+	for _, expected := range []string{"peer-2", "peer-1"} {
+		select {
+		case e := <-events:
+			if e.Key != expected {
+				t.Fatalf("expected event for: %v, got: %v", expected, e)
+			}
+			if e.Reg == nil {
+				t.Fatalf("expected registration with event: %v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected event for: %v", expected)
+		}
+	}
+
+	// Once the last subscriber leaves the watch stops.
+	cancel()
+	for range events {
+	}
+	select {
+	case <-sw.c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected shared watch to stop")
+	}
+}
+
+func TestSharedWatchDisconnectSlowSubscriber(t *testing.T) {
+	const buffer = 2
+	const nrEvents = 5
+
+	sw := newTestSharedWatch(buffer, DisconnectSlowSubscriber)
+	defer sw.cancel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, fast := sw.add(ctx)
+	_, slow := sw.add(ctx)
+
+	// The fast subscriber keeps up with every event, while
+	// the slow subscriber reads nothing.
+	for i := 0; i < nrEvents; i++ {
+		applyCreate(sw, i)
+		select {
+		case e := <-fast:
+			if e.Error != nil {
+				t.Fatalf("expected event for fast subscriber, got: %v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected fast subscriber to receive every event")
+		}
+	}
+
+	// The slow subscriber gets the events buffered, and the
+	// one in flight if it had been taken from the buffer, then
+	// the error.
+	n := 0
+	for e := range slow {
+		if e.Error != nil {
+			if e.Error != ErrSlowSubscriber {
+				t.Fatalf("expected error: %v, got: %v", ErrSlowSubscriber, e)
+			}
+			break
+		}
+		n++
+	}
+	if n < buffer || n > buffer+1 {
+		t.Fatalf("expected %v or %v events before the error, got: %v", buffer, buffer+1, n)
+	}
+	if _, open := <-slow; open {
+		t.Fatal("expected slow subscriber's channel to close")
+	}
+}
+
+func TestSharedWatchDefaultBuffer(t *testing.T) {
+	const nrEvents = 5
+
+	for _, policy := range []SlowSubscriberPolicy{DisconnectSlowSubscriber, BlockOnSlowSubscriber} {
+		sw := newTestSharedWatch(0, policy)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		_, events := sw.add(ctx)
+
+		// Without a buffer every event would disconnect,
+		// or block on, the subscriber which reads nothing.
+		applied := make(chan bool)
+		go func() {
+			for i := 0; i < nrEvents; i++ {
+				applyCreate(sw, i)
+			}
+			close(applied)
+		}()
+		select {
+		case <-applied:
+		case <-time.After(time.Second):
+			t.Fatalf("expected events to be buffered, policy: %v", policy)
+		}
+
+		for i := 0; i < nrEvents; i++ {
+			e := <-events
+			if e.Error != nil || e.Key != fmt.Sprintf("peer-%v", i) {
+				t.Fatalf("expected event for peer-%v, got: %v", i, e)
+			}
+		}
+		cancel()
+		sw.cancel()
+	}
+}
+
+func TestSharedWatchBlockOnSlowSubscriber(t *testing.T) {
+	const nrEvents = 3
+
+	sw := newTestSharedWatch(1, BlockOnSlowSubscriber)
+	defer sw.cancel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, slow := sw.add(ctx)
+
+	applied := make(chan bool)
+	go func() {
+		for i := 0; i < nrEvents; i++ {
+			applyCreate(sw, i)
+		}
+		close(applied)
+	}()
+
+	// One event is delivered, one is buffered, so
+	// the last is held up until the subscriber reads.
+	select {
+	case <-applied:
+		t.Fatal("expected the watch to block on the slow subscriber")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	for i := 0; i < nrEvents; i++ {
+		e := <-slow
+		if e.Error != nil || e.Key != fmt.Sprintf("peer-%v", i) {
+			t.Fatalf("expected event for peer-%v, got: %v", i, e)
+		}
+	}
+	select {
+	case <-applied:
+	case <-time.After(time.Second):
+		t.Fatal("expected the watch to continue")
+	}
+}
+
+func TestResumeWatchShared(t *testing.T) {
+	client, r, _ := bootstrap(t, start)
+	defer client.Close()
+	defer r.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, first, err := r.ResumeWatch(ctx, "shared-peer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := r.ResumeWatch(ctx, "shared-peer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.mu.Lock()
+	nrWatches := len(r.watches)
+	r.mu.Unlock()
+	if nrWatches != 1 {
+		t.Fatalf("expected 1 shared watch, got: %v", nrWatches)
+	}
+
+	timeout, cancelTimeout := timeoutContext()
+	defer cancelTimeout()
+	err = r.Register(timeout, "shared-peer-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, events := range []<-chan *WatchEvent{first, second} {
+		select {
+		case e := <-events:
+			if e.Type != Create || e.Key != "shared-peer-1" {
+				t.Fatalf("expected create of shared-peer-1, got: %v", e)
+			}
+		case <-timeout.Done():
+			t.Fatal("expected watch event")
+		}
+	}
+
+	cancel()
+	for range first {
+	}
+	for range second {
+	}
+	r.mu.Lock()
+	nrWatches = len(r.watches)
+	r.mu.Unlock()
+	if nrWatches != 0 {
+		t.Fatalf("expected shared watch to stop, got: %v watches", nrWatches)
+	}
+}
+
+func TestSharedWatchSubscribersDoNotShare(t *testing.T) {
+	sw := newTestSharedWatch(10, DisconnectSlowSubscriber)
+	defer sw.cancel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sw.apply(&WatchEvent{Key: "peer-1", Type: Create, Reg: &Registration{Key: "peer-1", Annotations: []string{"b", "a"}}}, 1)
+	first, firstEvents := sw.add(ctx)
+	second, secondEvents := sw.add(ctx)
+	if first[0].reg == second[0].reg {
+		t.Fatal("expected each subscriber to get its own registration")
+	}
+	first[0].reg.Annotations[0] = "changed"
+	if second[0].reg.Annotations[0] != "b" {
+		t.Fatalf("expected registration unchanged by other subscriber, got: %v", second[0].reg)
+	}
+
+	sw.apply(&WatchEvent{Key: "peer-2", Type: Create, Reg: &Registration{Key: "peer-2"}}, 2)
+	e1, e2 := <-firstEvents, <-secondEvents
+	if e1 == e2 || e1.Reg == e2.Reg {
+		t.Fatal("expected each subscriber to get its own event")
+	}
+}
+
+func TestSharedWatchValue(t *testing.T) {
+	rr := &Registry{
+		watches:              map[watchKey]*sharedWatch{},
+		WatchBuffer:          10,
+		SlowSubscriberPolicy: DisconnectSlowSubscriber,
+	}
+	state := map[string]*entry{
+		"limits": {value: &Value{Key: "limits", Data: []byte("a"), Revision: 1}, modRev: 1},
+	}
+	sw := newSharedWatch(rr, valueWatch, "limits", state, 1)
+	defer sw.cancel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	current, events := sw.add(ctx)
+	if len(current) != 1 || string(current[0].value.Data) != "a" {
+		t.Fatalf("expected current value: a, got: %v", current)
+	}
+
+	// A compaction resyncs the watch, only the
+	// change of the value is published.
+	sw.resync(map[string]*entry{
+		"limits": {value: &Value{Key: "limits", Data: []byte("b"), Revision: 3}, modRev: 3},
+	}, 3)
+	select {
+	case e := <-events:
+		if e.Type != Modify || e.value == nil || string(e.value.Data) != "b" {
+			t.Fatalf("expected modify of value to: b, got: %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected event")
+	}
+	sw.resync(map[string]*entry{}, 4)
+	select {
+	case e := <-events:
+		if e.Type != Delete || e.value != nil {
+			t.Fatalf("expected delete of value, got: %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected event")
+	}
+}
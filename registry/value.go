@@ -0,0 +1,169 @@
+package registry
+
+import (
+	"context"
+	"errors"
+
+	etcdv3 "github.com/coreos/etcd/clientv3"
+)
+
+var (
+	ErrValueChanged = errors.New("registry: value changed")
+)
+
+// Value stored in the registry. Unlike registrations, values
+// are not bound to the lease of any registry, they remain
+// until deleted.
+type Value struct {
+	Key  string
+	Data []byte
+	// Revision of the value's last modification, used to
+	// compare and swap the value.
+	Revision int64
+}
+
+// ValueEvent of a watched value. A nil Value means the value
+// was deleted.
+type ValueEvent struct {
+	Key   string
+	Value *Value
+	Error error
+}
+
+// GetValue under the given key, or ErrUnknownKey.
+func (rr *Registry) GetValue(c context.Context, key string) (*Value, error) {
+	getRes, err := rr.kv.Get(c, key, etcdv3.WithLimit(1))
+	if err != nil {
+		return nil, err
+	}
+	if getRes.Count == 0 {
+		return nil, ErrUnknownKey
+	}
+	kv := getRes.Kvs[0]
+	return &Value{Key: key, Data: kv.Value, Revision: kv.ModRevision}, nil
+}
+
+// PutValue under the given key, replacing any value.
+func (rr *Registry) PutValue(c context.Context, key string, data []byte) (*Value, error) {
+	putRes, err := rr.kv.Put(c, key, string(data))
+	if err != nil {
+		return nil, err
+	}
+	return &Value{Key: key, Data: data, Revision: putRes.Header.Revision}, nil
+}
+
+// CompareAndSwapValue under the given key, only if the value's
+// revision is still the given revision, otherwise ErrValueChanged
+// is returned. A revision of zero means the key must not have a
+// value yet.
+func (rr *Registry) CompareAndSwapValue(c context.Context, key string, data []byte, revision int64) (*Value, error) {
+	txnRes, err := rr.kv.Txn(c).
+		If(etcdv3.Compare(etcdv3.ModRevision(key), "=", revision)).
+		Then(etcdv3.OpPut(key, string(data))).
+		Commit()
+	if err != nil {
+		return nil, err
+	}
+	if !txnRes.Succeeded {
+		return nil, ErrValueChanged
+	}
+	return &Value{Key: key, Data: data, Revision: txnRes.Header.Revision}, nil
+}
+
+// DeleteValue under the given key.
+func (rr *Registry) DeleteValue(c context.Context, key string) error {
+	_, err := rr.kv.Delete(c, key)
+	return err
+}
+
+// WatchValue under the given key. The current value, nil if there
+// is none, is returned, and each change is sent on the channel. If
+// the underlying etcd watch closes or errors, the watch is resumed
+// after the last revision seen, or if that has been compacted, the
+// current value is sent if it changed. An error is only sent, and
+// the channel closed, after ResumeAttempts attempts in a row fail
+// to resume.
+//
+// Like resumable watches of registrations, watches of the same key
+// share one etcd watch, and each watcher has a buffer of WatchBuffer
+// events, dealt with according to SlowSubscriberPolicy when full.
+func (rr *Registry) WatchValue(c context.Context, key string) (*Value, <-chan *ValueEvent, error) {
+	entries, watchEvents, err := rr.subscribe(c, valueWatch, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	var current *Value
+	if len(entries) > 0 {
+		current = entries[0].value
+	}
+
+	valueEvents := make(chan *ValueEvent)
+	go func() {
+		defer close(valueEvents)
+		for we := range watchEvents {
+			ve := &ValueEvent{Key: key, Value: we.value, Error: we.Error}
+			select {
+			case <-c.Done():
+				return
+			case valueEvents <- ve:
+			}
+		}
+	}()
+
+	return current, valueEvents, nil
+}
+
+// listValue under the key, as the state of a watch of the
+// value, and the revision of the read.
+func (rr *Registry) listValue(c context.Context, key string) (map[string]*entry, int64, error) {
+	value, rev, err := rr.getValueAt(c, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	state := map[string]*entry{}
+	if value != nil {
+		state[key] = &entry{value: value, modRev: value.Revision}
+	}
+	return state, rev, nil
+}
+
+// newValueWatchEvent from an etcd event of a watched value.
+func newValueWatchEvent(ev *etcdv3.Event) *WatchEvent {
+	key := string(ev.Kv.Key)
+	we := &WatchEvent{Key: key}
+	if ev.IsCreate() {
+		we.Type = Create
+	} else if ev.IsModify() {
+		we.Type = Modify
+	} else {
+		we.Type = Delete
+		return we
+	}
+	we.value = &Value{Key: key, Data: ev.Kv.Value, Revision: ev.Kv.ModRevision}
+	return we
+}
+
+// clone of the value, sharing nothing with it, nil if
+// the value is nil.
+func (v *Value) clone() *Value {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	c.Data = append([]byte(nil), v.Data...)
+	return &c
+}
+
+// getValueAt returns the value under the key, nil if none,
+// and the revision of the read.
+func (rr *Registry) getValueAt(c context.Context, key string) (*Value, int64, error) {
+	getRes, err := rr.kv.Get(c, key, etcdv3.WithLimit(1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if getRes.Count == 0 {
+		return nil, getRes.Header.Revision, nil
+	}
+	kv := getRes.Kvs[0]
+	return &Value{Key: key, Data: kv.Value, Revision: kv.ModRevision}, getRes.Header.Revision, nil
+}
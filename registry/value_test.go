@@ -0,0 +1,99 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPutGetValue(t *testing.T) {
+	client, r, _ := bootstrap(t, dontStart)
+	defer client.Close()
+
+	timeout, cancel := timeoutContext()
+	defer cancel()
+
+	_, err := r.GetValue(timeout, "test-value")
+	if err != ErrUnknownKey {
+		t.Fatalf("expected error: %v, got: %v", ErrUnknownKey, err)
+	}
+
+	put, err := r.PutValue(timeout, "test-value", []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := r.GetValue(timeout, "test-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value.Data) != "a" || value.Revision != put.Revision {
+		t.Fatalf("expected value: a, at revision: %v, got: %s, at revision: %v", put.Revision, value.Data, value.Revision)
+	}
+
+	_, err = r.CompareAndSwapValue(timeout, "test-value", []byte("b"), put.Revision-1)
+	if err != ErrValueChanged {
+		t.Fatalf("expected error: %v, got: %v", ErrValueChanged, err)
+	}
+	_, err = r.CompareAndSwapValue(timeout, "test-value", []byte("b"), put.Revision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.CompareAndSwapValue(timeout, "test-value-new", []byte("c"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchValue(t *testing.T) {
+	client, r, _ := bootstrap(t, dontStart)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	current, watch, err := r.WatchValue(ctx, "test-watched-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != nil {
+		t.Fatal("expected no current value")
+	}
+	_, _, err = r.WatchValue(ctx, "test-watched-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.mu.Lock()
+	nrWatches := len(r.watches)
+	r.mu.Unlock()
+	if nrWatches != 1 {
+		t.Fatalf("expected 1 shared watch, got: %v", nrWatches)
+	}
+
+	timeout, cancelTimeout := timeoutContext()
+	defer cancelTimeout()
+	_, err = r.PutValue(timeout, "test-watched-value", []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.DeleteValue(timeout, "test-watched-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"a", ""} {
+		select {
+		case ve := <-watch:
+			if ve.Error != nil {
+				t.Fatal(ve.Error)
+			}
+			if expected == "" && ve.Value != nil {
+				t.Fatalf("expected deleted value, got: %s", ve.Value.Data)
+			}
+			if expected != "" && (ve.Value == nil || string(ve.Value.Data) != expected) {
+				t.Fatalf("expected value: %v", expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
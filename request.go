@@ -46,6 +46,11 @@ type request struct {
 	failure  chan error
 	response chan *Delivery
 	finished bool
+	// Compression of the response, applied if the
+	// requester accepts it and the response is at
+	// least the threshold size.
+	compressionThreshold int
+	acceptCompression    []Delivery_Compression
 }
 
 // Context of request.
@@ -86,14 +91,19 @@ func (req *request) Respond(msg interface{}) error {
 
 	// Encode the message here, in the thread of
 	// execution of the caller.
-	typeName, data, err := codec.Marshal(msg)
+	typeName, codecName, data, compression, err := req.encode(msg)
 	if err != nil {
 		return err
 	}
 	res := &Delivery{
-		Ver:      Delivery_V1,
-		Data:     data,
-		TypeName: typeName,
+		Ver:         Delivery_V1,
+		Data:        data,
+		TypeName:    typeName,
+		CodecName:   codecName,
+		Compression: compression,
+		// Tell the requester what it may compress
+		// its next requests to this peer with.
+		AcceptCompression: supportedCompression,
 	}
 
 	// Send the response bytes. Again, the bytes need
@@ -106,3 +116,29 @@ func (req *request) Respond(msg interface{}) error {
 		panic("grid: respond called multiple times")
 	}
 }
+
+// encode the response message, compressed if the requester accepts
+// it. gRPC encodes the response after Process has returned, so the
+// data must not be held in a pooled buffer. Only when compressing
+// is a pooled buffer used, since the compressed data is new. Data
+// which ends up not compressed is detached from the buffer.
+func (req *request) encode(msg interface{}) (string, string, []byte, Delivery_Compression, error) {
+	if req.compressionThreshold <= 0 || !acceptsCompression(req.acceptCompression, Delivery_Gzip) {
+		typeName, codecName, data, err := codec.MarshalCodec(msg)
+		return typeName, codecName, data, Delivery_None, err
+	}
+
+	buf, err := codec.MarshalBuffer(msg)
+	if err != nil {
+		return "", "", nil, Delivery_None, err
+	}
+	defer buf.Release()
+	data, compression, err := compress(buf.Data, req.compressionThreshold, req.acceptCompression)
+	if err != nil {
+		return "", "", nil, Delivery_None, err
+	}
+	if compression == Delivery_None {
+		data = buf.Detach()
+	}
+	return buf.TypeName, buf.CodecName, data, compression, nil
+}
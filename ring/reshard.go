@@ -0,0 +1,440 @@
+package ring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lytics/grid"
+)
+
+var (
+	// ErrEmptyRing when a ring without members is used in a reshard.
+	ErrEmptyRing = errors.New("ring: empty ring")
+	// ErrTooManySlots when the old and new layouts of a reshard have
+	// no small common modulus of hash slots.
+	ErrTooManySlots = errors.New("ring: too many slots")
+	// ErrUnsupportedMultiRing when a multi-ring implementation other
+	// than the one returned by NewMultiRing is resharded.
+	ErrUnsupportedMultiRing = errors.New("ring: unsupported multi-ring")
+)
+
+const (
+	// maxSlots bounds the number of hash slots a reshard plan
+	// may track, which is the least common multiple of the
+	// sizes of the old and new layouts.
+	maxSlots = 1 << 20
+)
+
+func init() {
+	grid.Register(Handoff{})
+}
+
+// NewMessage for decoding, see codec.Constructor.
+func (Handoff) NewMessage() interface{} { return &Handoff{} }
+
+// layout of a ring or multi-ring, as seen by a reshard. The hash
+// space is divided into modulus slots, each owned by one actor.
+type layout struct {
+	id      string
+	modulus uint64
+	owner   func(slot uint64) string
+	actors  []*grid.ActorStart
+	// reserved actors, of the reserved rings of a multi-ring,
+	// which own no slots.
+	reserved []*grid.ActorStart
+}
+
+func ringLayout(r Ring) (*layout, error) {
+	actors := r.Actors()
+	if len(actors) == 0 {
+		return nil, ErrEmptyRing
+	}
+	return &layout{
+		id:      r.ID(),
+		modulus: uint64(len(actors)),
+		owner:   r.ByUint64,
+		actors:  actors,
+	}, nil
+}
+
+func multiRingLayout(mr MultiRing) (*layout, error) {
+	m, ok := mr.(*multi)
+	if !ok {
+		return nil, ErrUnsupportedMultiRing
+	}
+	routed := uint64(m.totalRings - m.reservedRings)
+	if routed == 0 {
+		return nil, ErrEmptyRing
+	}
+	members := uint64(len(m.rings[0].Actors()))
+	if members == 0 {
+		return nil, ErrEmptyRing
+	}
+	var actors, reserved []*grid.ActorStart
+	for i, r := range m.rings {
+		if uint64(i) < routed {
+			actors = append(actors, r.Actors()...)
+		} else {
+			reserved = append(reserved, r.Actors()...)
+		}
+	}
+	modulus, ok := lcm(routed, members)
+	if !ok {
+		return nil, ErrTooManySlots
+	}
+	return &layout{
+		id:      m.rings[0].(*ring).actortype,
+		modulus: modulus,
+		owner: func(slot uint64) string {
+			return m.rings[slot%routed].ByUint64(slot)
+		},
+		actors:   actors,
+		reserved: reserved,
+	}, nil
+}
+
+// Move of a single hash slot from one actor to another.
+type Move struct {
+	Slot uint64
+	From string
+	To   string
+}
+
+// Plan of a reshard between an old and a new layout. The hash
+// space is divided into Modulus slots, and each slot whose
+// owner differs between the layouts is listed in Moves.
+type Plan struct {
+	Modulus uint64
+	Moves   []*Move
+	// Added actors exist only in the new layout, they must
+	// be started before the reshard is run.
+	Added []*grid.ActorStart
+	// Removed actors exist only in the old layout, they can
+	// be stopped once the reshard is authoritative.
+	Removed []*grid.ActorStart
+	// ReservedAdded and ReservedRemoved actors, of the reserved
+	// rings of a multi-ring, exist only in the new or the old
+	// layout. They own no slots, so they can be started and
+	// stopped independently of the reshard. Actors whose ring
+	// only changes between routed and reserved are in neither.
+	ReservedAdded   []*grid.ActorStart
+	ReservedRemoved []*grid.ActorStart
+
+	id string
+	to *layout
+}
+
+// PlanReshard computes which hash slots move between actors when
+// the ring from is replaced by the ring to. Only keys routed with
+// ByHashedString or ByHashedBytes are covered by the plan.
+func PlanReshard(from, to Ring) (*Plan, error) {
+	fl, err := ringLayout(from)
+	if err != nil {
+		return nil, err
+	}
+	tl, err := ringLayout(to)
+	if err != nil {
+		return nil, err
+	}
+	return newPlan(fl, tl)
+}
+
+// PlanMultiReshard computes which hash slots move between actors
+// when the multi-ring from is replaced by the multi-ring to. Keys
+// are expected to be routed by choosing a ring with ByHashedString
+// and then a member of that ring with ByHashedString, using the
+// same key. The actors of reserved rings own no slots, they are
+// only reported in the plan's ReservedAdded and ReservedRemoved.
+func PlanMultiReshard(from, to MultiRing) (*Plan, error) {
+	fl, err := multiRingLayout(from)
+	if err != nil {
+		return nil, err
+	}
+	tl, err := multiRingLayout(to)
+	if err != nil {
+		return nil, err
+	}
+	return newPlan(fl, tl)
+}
+
+func newPlan(from, to *layout) (*Plan, error) {
+	modulus, ok := lcm(from.modulus, to.modulus)
+	if !ok {
+		return nil, ErrTooManySlots
+	}
+	p := &Plan{
+		Modulus: modulus,
+		id:      to.id,
+		to:      to,
+	}
+	for slot := uint64(0); slot < modulus; slot++ {
+		src := from.owner(slot)
+		dst := to.owner(slot)
+		if src != dst {
+			p.Moves = append(p.Moves, &Move{Slot: slot, From: src, To: dst})
+		}
+	}
+
+	p.Added = missing(to.actors, from)
+	p.Removed = missing(from.actors, to)
+	p.ReservedAdded = missing(to.reserved, from)
+	p.ReservedRemoved = missing(from.reserved, to)
+	return p, nil
+}
+
+// missing returns the actors which are not in the layout,
+// neither as routed nor as reserved actors.
+func missing(actors []*grid.ActorStart, l *layout) []*grid.ActorStart {
+	existing := make(map[string]bool)
+	for _, a := range l.actors {
+		existing[a.Name] = true
+	}
+	for _, a := range l.reserved {
+		existing[a.Name] = true
+	}
+	var res []*grid.ActorStart
+	for _, a := range actors {
+		if !existing[a.Name] {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// Handoffs of the plan, one for each pair of actors between which
+// at least one slot moves. The handoffs are sorted by sender, then
+// by receiver.
+func (p *Plan) Handoffs() []*Handoff {
+	byPair := make(map[string]*Handoff)
+	for _, m := range p.Moves {
+		pair := m.From + "/" + m.To
+		h, ok := byPair[pair]
+		if !ok {
+			h = &Handoff{
+				Ring:    p.id,
+				From:    m.From,
+				To:      m.To,
+				Modulus: p.Modulus,
+			}
+			byPair[pair] = h
+		}
+		h.Slots = append(h.Slots, m.Slot)
+	}
+	handoffs := make([]*Handoff, 0, len(byPair))
+	for _, h := range byPair {
+		handoffs = append(handoffs, h)
+	}
+	sort.Slice(handoffs, func(i, j int) bool {
+		if handoffs[i].From != handoffs[j].From {
+			return handoffs[i].From < handoffs[j].From
+		}
+		return handoffs[i].To < handoffs[j].To
+	})
+	return handoffs
+}
+
+// HasHashedString returns true if the key belongs to one of
+// the slots being handed off.
+func (m *Handoff) HasHashedString(key string) bool {
+	return m.hasSlot(hashSlot([]byte(key), m.Modulus))
+}
+
+// HasHashedBytes returns true if the key belongs to one of
+// the slots being handed off.
+func (m *Handoff) HasHashedBytes(key []byte) bool {
+	return m.hasSlot(hashSlot(key, m.Modulus))
+}
+
+func (m *Handoff) hasSlot(slot uint64) bool {
+	i := sort.Search(len(m.Slots), func(i int) bool { return m.Slots[i] >= slot })
+	return i < len(m.Slots) && m.Slots[i] == slot
+}
+
+// Resharder coordinates moving state from the old owners of hash
+// slots to their new owners. Each old owner is sent a Handoff
+// message naming the new owner and the slots, and it must move
+// the state for those slots to the new owner before it responds.
+// Until a slot's handoff is acknowledged, requests for keys in
+// that slot are routed to both the old and the new owner.
+//
+// Example usage:
+//
+//     plan, err := ring.PlanReshard(ring.New("consumer", 18), ring.New("consumer", 24))
+//     ...
+//     for _, start := range plan.Added {
+//         // Start new members of the ring.
+//     }
+//
+//     rs := ring.NewResharder(client, plan)
+//     go rs.Run(ctx)
+//
+//     // Route, possibly to both old and new owner.
+//     res, err := client.Broadcast(timeout, rs.Group(key), msg)
+type Resharder struct {
+	mu       sync.Mutex
+	client   *grid.Client
+	plan     *Plan
+	handoffs []*Handoff
+	moving   map[uint64]*Move
+	pending  map[*Handoff]bool
+	finished chan bool
+	// Timeout of each handoff request, default is 1 minute.
+	Timeout time.Duration
+	// Backoff between failed handoff requests, default is 1 second.
+	Backoff time.Duration
+}
+
+// NewResharder for the given plan, which uses the client to send
+// handoff messages.
+func NewResharder(client *grid.Client, plan *Plan) *Resharder {
+	rs := &Resharder{
+		client:   client,
+		plan:     plan,
+		handoffs: plan.Handoffs(),
+		moving:   make(map[uint64]*Move),
+		pending:  make(map[*Handoff]bool),
+		finished: make(chan bool),
+		Timeout:  1 * time.Minute,
+		Backoff:  1 * time.Second,
+	}
+	for _, m := range plan.Moves {
+		rs.moving[m.Slot] = m
+	}
+	for _, h := range rs.handoffs {
+		rs.pending[h] = true
+	}
+	if len(rs.pending) == 0 {
+		close(rs.finished)
+	}
+	return rs
+}
+
+// Run the reshard, sending each handoff to its old owner and
+// retrying failed handoffs until they succeed or the context
+// is done. Run returns once the new layout is authoritative.
+func (rs *Resharder) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, h := range rs.handoffs {
+		wg.Add(1)
+		go func(h *Handoff) {
+			defer wg.Done()
+			rs.runHandoff(ctx, h)
+		}(h)
+	}
+	wg.Wait()
+
+	select {
+	case <-rs.finished:
+		return nil
+	default:
+		return grid.ErrContextFinished
+	}
+}
+
+func (rs *Resharder) runHandoff(ctx context.Context, h *Handoff) {
+	for {
+		timeout, cancel := context.WithTimeout(ctx, rs.Timeout)
+		_, err := rs.client.RequestC(timeout, h.From, h)
+		cancel()
+		if err == nil {
+			rs.complete(h)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rs.Backoff):
+		}
+	}
+}
+
+func (rs *Resharder) complete(h *Handoff) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if !rs.pending[h] {
+		return
+	}
+	delete(rs.pending, h)
+	for _, slot := range h.Slots {
+		delete(rs.moving, slot)
+	}
+	if len(rs.pending) == 0 {
+		close(rs.finished)
+	}
+}
+
+// Progress of the reshard as the number of completed
+// handoffs and the total number of handoffs.
+func (rs *Resharder) Progress() (done, total int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	total = len(rs.handoffs)
+	return total - len(rs.pending), total
+}
+
+// Done reports closed once the new layout is authoritative.
+func (rs *Resharder) Done() <-chan bool {
+	return rs.finished
+}
+
+// ByHashedString returns the actor names which should receive
+// requests for the key. While the key's slot is being handed
+// off both the old and the new owner are returned, old owner
+// first, otherwise just the owner in the new layout.
+func (rs *Resharder) ByHashedString(key string) []string {
+	return rs.owners(hashSlot([]byte(key), rs.plan.Modulus))
+}
+
+// ByHashedBytes returns the actor names which should receive
+// requests for the key, see ByHashedString.
+func (rs *Resharder) ByHashedBytes(key []byte) []string {
+	return rs.owners(hashSlot(key, rs.plan.Modulus))
+}
+
+// Group of actors which should receive requests for the key,
+// for use with the client's Broadcast method.
+func (rs *Resharder) Group(key string) *grid.Group {
+	return grid.NewListGroup(rs.ByHashedString(key)...)
+}
+
+func (rs *Resharder) owners(slot uint64) []string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if m, ok := rs.moving[slot]; ok {
+		return []string{m.From, m.To}
+	}
+	return []string{rs.plan.to.owner(slot)}
+}
+
+// String of the resharder's progress.
+func (rs *Resharder) String() string {
+	done, total := rs.Progress()
+	return fmt.Sprintf("reshard: %v: %v of %v handoffs complete", rs.plan.id, done, total)
+}
+
+func hashSlot(key []byte, modulus uint64) uint64 {
+	h := fnv.New64()
+	h.Write(key)
+	return h.Sum64() % modulus
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// lcm of a and b, and false if it is larger than maxSlots.
+func lcm(a, b uint64) (uint64, bool) {
+	v := a / gcd(a, b) * b
+	return v, v <= maxSlots
+}
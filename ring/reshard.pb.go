@@ -0,0 +1,96 @@
+// Code generated by protoc-gen-go.
+// source: reshard.proto
+// DO NOT EDIT!
+
+/*
+Package ring is a generated protocol buffer package.
+
+It is generated from these files:
+	reshard.proto
+
+It has these top-level messages:
+	Handoff
+*/
+package ring
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type Handoff struct {
+	Ring    string   `protobuf:"bytes,1,opt,name=ring" json:"ring,omitempty"`
+	From    string   `protobuf:"bytes,2,opt,name=from" json:"from,omitempty"`
+	To      string   `protobuf:"bytes,3,opt,name=to" json:"to,omitempty"`
+	Modulus uint64   `protobuf:"varint,4,opt,name=modulus" json:"modulus,omitempty"`
+	Slots   []uint64 `protobuf:"varint,5,rep,packed,name=slots" json:"slots,omitempty"`
+}
+
+func (m *Handoff) Reset()                    { *m = Handoff{} }
+func (m *Handoff) String() string            { return proto.CompactTextString(m) }
+func (*Handoff) ProtoMessage()               {}
+func (*Handoff) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *Handoff) GetRing() string {
+	if m != nil {
+		return m.Ring
+	}
+	return ""
+}
+
+func (m *Handoff) GetFrom() string {
+	if m != nil {
+		return m.From
+	}
+	return ""
+}
+
+func (m *Handoff) GetTo() string {
+	if m != nil {
+		return m.To
+	}
+	return ""
+}
+
+func (m *Handoff) GetModulus() uint64 {
+	if m != nil {
+		return m.Modulus
+	}
+	return 0
+}
+
+func (m *Handoff) GetSlots() []uint64 {
+	if m != nil {
+		return m.Slots
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Handoff)(nil), "ring.Handoff")
+}
+
+func init() { proto.RegisterFile("reshard.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 134 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0x2d, 0x4a, 0x2d, 0xce,
+	0x48, 0x2c, 0x4a, 0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x29, 0xca, 0xcc, 0x4b, 0x57,
+	0x2a, 0xe4, 0x62, 0xf7, 0x48, 0xcc, 0x4b, 0xc9, 0x4f, 0x4b, 0x13, 0x12, 0xe2, 0x02, 0x0b, 0x49,
+	0x30, 0x2a, 0x30, 0x6a, 0x70, 0x06, 0x81, 0xd9, 0x20, 0xb1, 0xb4, 0xa2, 0xfc, 0x5c, 0x09, 0x26,
+	0x88, 0x18, 0x88, 0x2d, 0xc4, 0xc7, 0xc5, 0x54, 0x92, 0x2f, 0xc1, 0x0c, 0x16, 0x61, 0x2a, 0xc9,
+	0x17, 0x92, 0xe0, 0x62, 0xcf, 0xcd, 0x4f, 0x29, 0xcd, 0x29, 0x2d, 0x96, 0x60, 0x51, 0x60, 0xd4,
+	0x60, 0x09, 0x82, 0x71, 0x85, 0x44, 0xb8, 0x58, 0x8b, 0x73, 0xf2, 0x4b, 0x8a, 0x25, 0x58, 0x15,
+	0x98, 0x35, 0x58, 0x82, 0x20, 0x9c, 0x24, 0x36, 0xb0, 0xfd, 0xc6, 0x80, 0x01, 0x00, 0x35, 0x0b,
+	0xd0, 0x45, 0x90, 0x00, 0x00, 0x00,
+}
@@ -0,0 +1,241 @@
+package ring
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPlanReshard(t *testing.T) {
+	from := New(name, 2)
+	to := New(name, 3)
+
+	plan, err := PlanReshard(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Modulus != 6 {
+		t.Fatalf("expected modulus 6, got: %v", plan.Modulus)
+	}
+
+	// Slots 2, 3, 4, and 5 change owner, slots
+	// 0 and 1 stay with reader-0 and reader-1.
+	expected := map[uint64][2]string{
+		2: {"reader-0", "reader-2"},
+		3: {"reader-1", "reader-0"},
+		4: {"reader-0", "reader-1"},
+		5: {"reader-1", "reader-2"},
+	}
+	if len(plan.Moves) != len(expected) {
+		t.Fatalf("expected %v moves, got: %v", len(expected), len(plan.Moves))
+	}
+	for _, m := range plan.Moves {
+		e, ok := expected[m.Slot]
+		if !ok {
+			t.Fatalf("unexpected move of slot: %v", m.Slot)
+		}
+		if m.From != e[0] || m.To != e[1] {
+			t.Fatalf("slot %v expected move %v -> %v, got: %v -> %v", m.Slot, e[0], e[1], m.From, m.To)
+		}
+	}
+
+	if len(plan.Added) != 1 || plan.Added[0].Name != "reader-2" {
+		t.Fatalf("expected reader-2 to be added, got: %v", plan.Added)
+	}
+	if len(plan.Removed) != 0 {
+		t.Fatalf("expected no actors removed, got: %v", plan.Removed)
+	}
+}
+
+func TestPlanReshardShrink(t *testing.T) {
+	plan, err := PlanReshard(New(name, 4), New(name, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Added) != 0 {
+		t.Fatalf("expected no actors added, got: %v", plan.Added)
+	}
+	if len(plan.Removed) != 2 {
+		t.Fatalf("expected 2 actors removed, got: %v", plan.Removed)
+	}
+}
+
+func TestPlanReshardEmptyRing(t *testing.T) {
+	_, err := PlanReshard(New(name, 0), New(name, 2))
+	if err != ErrEmptyRing {
+		t.Fatal("expected empty ring error")
+	}
+}
+
+func TestPlanReshardTooManySlots(t *testing.T) {
+	_, err := PlanReshard(New(name, 1999), New(name, 2003))
+	if err != ErrTooManySlots {
+		t.Fatal("expected too many slots error")
+	}
+}
+
+func TestPlanHandoffs(t *testing.T) {
+	plan, err := PlanReshard(New(name, 2), New(name, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handoffs := plan.Handoffs()
+	if len(handoffs) != 4 {
+		t.Fatalf("expected 4 handoffs, got: %v", len(handoffs))
+	}
+	for i := 1; i < len(handoffs); i++ {
+		if handoffs[i-1].From > handoffs[i].From {
+			t.Fatal("expected handoffs sorted by sender")
+		}
+	}
+
+	// Every key must be in exactly the handoff that moves
+	// it, or in none if its owner does not change.
+	from := New(name, 2)
+	to := New(name, 3)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		src := from.ByHashedString(key)
+		dst := to.ByHashedString(key)
+		found := 0
+		for _, h := range handoffs {
+			if h.HasHashedString(key) {
+				found++
+				if h.From != src || h.To != dst {
+					t.Fatalf("key %v in wrong handoff: %v", key, h)
+				}
+			}
+		}
+		if src == dst && found != 0 {
+			t.Fatalf("key %v does not move but is in a handoff", key)
+		}
+		if src != dst && found != 1 {
+			t.Fatalf("key %v moves but is in %v handoffs", key, found)
+		}
+	}
+}
+
+func TestPlanMultiReshard(t *testing.T) {
+	from := NewMultiRing(name, 2, 2, 0)
+	to := NewMultiRing(name, 2, 3, 0)
+
+	plan, err := PlanMultiReshard(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Added) != 2 {
+		t.Fatalf("expected 2 actors added, got: %v", plan.Added)
+	}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		src := from.ByHashedString(key).ByHashedString(key)
+		dst := to.ByHashedString(key).ByHashedString(key)
+		slot := hashSlot([]byte(key), plan.Modulus)
+		moved := false
+		for _, m := range plan.Moves {
+			if m.Slot == slot {
+				moved = true
+				if m.From != src || m.To != dst {
+					t.Fatalf("key %v expected move %v -> %v, got: %v -> %v", key, src, dst, m.From, m.To)
+				}
+			}
+		}
+		if moved != (src != dst) {
+			t.Fatalf("key %v moved: %v, but owners: %v -> %v", key, moved, src, dst)
+		}
+	}
+}
+
+func TestPlanMultiReshardReserved(t *testing.T) {
+	// One more reserved ring, of the same rings.
+	from := NewMultiRing(name, 2, 4, 1)
+	to := NewMultiRing(name, 2, 4, 2)
+
+	plan, err := PlanMultiReshard(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Added) != 0 || len(plan.Removed) != 0 {
+		t.Fatalf("expected no actors added or removed, got: %v, %v", plan.Added, plan.Removed)
+	}
+	if len(plan.ReservedAdded) != 0 || len(plan.ReservedRemoved) != 0 {
+		t.Fatalf("expected no reserved actors added or removed, got: %v, %v", plan.ReservedAdded, plan.ReservedRemoved)
+	}
+	for _, m := range plan.Moves {
+		for _, a := range to.Rings()[2].Actors() {
+			if m.To == a.Name {
+				t.Fatalf("expected no slot moved to reserved actor: %v", a.Name)
+			}
+		}
+	}
+
+	// A new reserved ring is reported apart from
+	// the routed actors.
+	to = NewMultiRing(name, 2, 5, 2)
+	plan, err = PlanMultiReshard(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Added) != 0 {
+		t.Fatalf("expected no actors added, got: %v", plan.Added)
+	}
+	if len(plan.ReservedAdded) != 2 {
+		t.Fatalf("expected 2 reserved actors added, got: %v", plan.ReservedAdded)
+	}
+	for _, a := range plan.ReservedAdded {
+		for _, m := range plan.Moves {
+			if m.To == a.Name {
+				t.Fatalf("expected no slot moved to reserved actor: %v", a.Name)
+			}
+		}
+	}
+
+	plan, err = PlanMultiReshard(to, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Removed) != 0 || len(plan.ReservedRemoved) != 2 {
+		t.Fatalf("expected 2 reserved actors removed, got: %v, %v", plan.Removed, plan.ReservedRemoved)
+	}
+}
+
+func TestResharderRouting(t *testing.T) {
+	from := New(name, 2)
+	to := New(name, 3)
+	plan, err := PlanReshard(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs := NewResharder(nil, plan)
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		owners := rs.ByHashedString(key)
+		src := from.ByHashedString(key)
+		dst := to.ByHashedString(key)
+		if src == dst && len(owners) != 1 {
+			t.Fatalf("expected single owner for key %v, got: %v", key, owners)
+		}
+		if src != dst && (len(owners) != 2 || owners[0] != src || owners[1] != dst) {
+			t.Fatalf("expected dual routing for key %v, got: %v", key, owners)
+		}
+	}
+
+	for _, h := range rs.handoffs {
+		rs.complete(h)
+	}
+	if done, total := rs.Progress(); done != total {
+		t.Fatalf("expected all handoffs done, got: %v of %v", done, total)
+	}
+	select {
+	case <-rs.Done():
+	default:
+		t.Fatal("expected reshard to be done")
+	}
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		owners := rs.ByHashedString(key)
+		if len(owners) != 1 || owners[0] != to.ByHashedString(key) {
+			t.Fatalf("expected new owner for key %v, got: %v", key, owners)
+		}
+	}
+}
@@ -2,11 +2,12 @@ package grid
 
 import (
 	"context"
-	"fmt"
 	"net"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	etcdv3 "github.com/coreos/etcd/clientv3"
@@ -14,12 +15,22 @@ import (
 	"github.com/lytics/grid/registry"
 	netcontext "golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
 const (
 	contextKey = "grid-context-key-xboKEsHA26"
 )
 
+// runningActor started by the server, and the
+// cancel function of its context.
+type runningActor struct {
+	actor  Actor
+	cancel func()
+}
+
 type contextVal struct {
 	server    *Server
 	actorID   string
@@ -28,18 +39,24 @@ type contextVal struct {
 
 // Server of a grid.
 type Server struct {
-	mu        sync.Mutex
-	ctx       context.Context
-	cancel    func()
-	cfg       ServerCfg
-	etcd      *etcdv3.Client
-	grpc      *grpc.Server
-	stop      sync.Once
-	fatalErr  chan error
-	finalErr  error
-	actors    map[string]MakeActor
-	registry  *registry.Registry
-	mailboxes map[string]*Mailbox
+	mu         sync.Mutex
+	ctx        context.Context
+	cancel     func()
+	cfg        ServerCfg
+	etcd       *etcdv3.Client
+	grpc       *grpc.Server
+	stop       sync.Once
+	fatalErr   chan error
+	finalErr   error
+	actors     map[string]MakeActor
+	registry   *registry.Registry
+	mailboxes  map[string]*Mailbox
+	singletons map[string]*singleton
+	running    map[string]*runningActor
+	draining   bool
+	refusing   bool
+	inflight   int64
+	health     *health.Server
 }
 
 // NewServer for the grid. The namespace must contain only characters
@@ -50,15 +67,21 @@ func NewServer(etcd *etcdv3.Client, cfg ServerCfg) (*Server, error) {
 	if !isNameValid(cfg.Namespace) {
 		return nil, ErrInvalidNamespace
 	}
+	if _, err := keyspace(cfg.RootPrefix); err != nil {
+		return nil, err
+	}
 	if etcd == nil {
 		return nil, ErrNilEtcd
 	}
 	return &Server{
-		cfg:      cfg,
-		etcd:     etcd,
-		grpc:     grpc.NewServer(),
-		actors:   map[string]MakeActor{},
-		fatalErr: make(chan error, 1),
+		cfg:        cfg,
+		etcd:       etcd,
+		grpc:       grpc.NewServer(serverOptions(cfg)...),
+		actors:     map[string]MakeActor{},
+		singletons: map[string]*singleton{},
+		running:    map[string]*runningActor{},
+		fatalErr:   make(chan error, 1),
+		health:     health.NewServer(),
 	}, nil
 }
 
@@ -66,7 +89,8 @@ func NewServer(etcd *etcdv3.Client, cfg ServerCfg) (*Server, error) {
 // a peer it will use the registered definitions to make and run
 // the actor. If an actor with actorType "leader" is registered
 // it will be started automatically when the Serve method is
-// called.
+// called, other actor types can be started automatically by
+// registering them with RegisterSingleton.
 func (s *Server) RegisterDef(actorType string, f MakeActor) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -84,18 +108,25 @@ func (s *Server) Context() context.Context {
 }
 
 // Serve the grid on the listener. The listener address type must be
-// net.TCPAddr, otherwise an error will be returned.
+// net.TCPAddr or net.UnixAddr, otherwise an error will be returned.
+// A TCP listener bound to an unspecified address, such as ":7777",
+// requires an advertise address in the server's config.
 func (s *Server) Serve(lis net.Listener) error {
 	// Create a registry client, through which other
 	// entities like peers, actors, and mailboxes
 	// will be discovered.
-	r, err := registry.New(s.etcd)
+	prefix, err := keyspace(s.cfg.RootPrefix)
+	if err != nil {
+		return err
+	}
+	r, err := registry.NewWithPrefix(s.etcd, prefix)
 	if err != nil {
 		return err
 	}
 	s.registry = r
 	s.registry.Timeout = s.cfg.Timeout
 	s.registry.LeaseDuration = s.cfg.LeaseDuration
+	s.registry.AdvertiseAddress = s.cfg.AdvertiseAddress
 
 	// Set registry logger.
 	if s.cfg.Logger != nil {
@@ -130,14 +161,21 @@ func (s *Server) Serve(lis net.Listener) error {
 	}
 
 	// Register the namespace name, other peers can search
-	// for this to discover each other.
+	// for this to discover each other. The registration
+	// also publishes the message types this peer can
+	// decode, so that clients can check them up front.
+	schemasChanged := codec.Changed()
 	timeoutC, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
-	err = s.registry.Register(timeoutC, nsName, s.cfg.Annotations...)
+	err = s.registry.RegisterWithSchemas(timeoutC, nsName, codec.Schemas(), s.cfg.Annotations...)
 	cancel()
 	if err != nil {
 		return err
 	}
 
+	// Publish the schemas again whenever message
+	// types are registered after this point.
+	s.monitorSchemas(nsName, schemasChanged)
+
 	// Create the mailboxes map.
 	s.mu.Lock()
 	s.mailboxes = make(map[string]*Mailbox)
@@ -153,16 +191,24 @@ func (s *Server) Serve(lis net.Listener) error {
 	}
 	go s.runMailbox(mailbox)
 
-	// Start the leader actor, and monitor, ie: make sure
-	// that it's running.
-	s.monitorLeader()
+	// Start the leader and other singleton actors, and
+	// monitor, ie: make sure that they're running.
+	s.monitorSingletons()
 
 	// Monitor for fatal errors.
 	s.monitorFatalErrors()
 
+	// Report health, through the standard gRPC health
+	// service, until the server is stopped.
+	s.monitorHealth()
+
 	// gRPC dance to start the gRPC server. The Serve
 	// method blocks still stopped via a call to Stop.
 	RegisterWireServer(s.grpc, s)
+	healthpb.RegisterHealthServer(s.grpc, s.health)
+	if s.cfg.EnableReflection {
+		reflection.Register(s.grpc)
+	}
 	err = s.grpc.Serve(lis)
 	// Something in gRPC returns the "use of..." error
 	// message even though it stopped fine. Catch that
@@ -179,6 +225,13 @@ func (s *Server) Serve(lis net.Listener) error {
 // Stop the server, blocking until all mailboxes registered with
 // this server have called their close method.
 func (s *Server) Stop() {
+	s.shutdown(context.Background())
+}
+
+// shutdown the server, blocking until all mailboxes registered with
+// this server have called their close method, or the context is done.
+// The names of the mailboxes still open are returned.
+func (s *Server) shutdown(c context.Context) []string {
 	logMailboxes := func() {
 		s.mu.Lock()
 		defer s.mu.Unlock()
@@ -187,22 +240,38 @@ func (s *Server) Stop() {
 		}
 	}
 
-	zeroMailboxes := func() bool {
+	openMailboxes := func() []string {
 		s.mu.Lock()
 		defer s.mu.Unlock()
-		return len(s.mailboxes) == 0
+		names := make([]string, 0, len(s.mailboxes))
+		for _, mailbox := range s.mailboxes {
+			names = append(names, mailbox.Name())
+		}
+		sort.Strings(names)
+		return names
 	}
 
+	var open []string
 	s.stop.Do(func() {
 		if s.cancel == nil {
 			return
 		}
+		s.setServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
 		s.cancel()
 
 		t0 := time.Now()
+	wait:
 		for {
-			time.Sleep(200 * time.Millisecond)
-			if zeroMailboxes() {
+			select {
+			case <-c.Done():
+				open = openMailboxes()
+				for _, name := range open {
+					s.logf("%v: mailbox failed to close: %v", s.cfg.Namespace, name)
+				}
+				break wait
+			case <-time.After(200 * time.Millisecond):
+			}
+			if len(openMailboxes()) == 0 {
 				break
 			}
 			if time.Now().Sub(t0) > 20*time.Second {
@@ -214,11 +283,23 @@ func (s *Server) Stop() {
 		s.registry.Stop()
 		s.grpc.Stop()
 	})
+	return open
 }
 
 // Process a request and return a response. Implements the interface for
 // gRPC definition of the wire service. Consider this a private method.
 func (s *Server) Process(c netcontext.Context, d *Delivery) (*Delivery, error) {
+	atomic.AddInt64(&s.inflight, 1)
+	defer atomic.AddInt64(&s.inflight, -1)
+
+	// Refuse new requests once the handoffs of a drain are
+	// done, counting them first, so that Drain waits only
+	// for those accepted. Until then actors, and those they
+	// hand off to, must still be reachable.
+	if s.isRefusing() {
+		return nil, ErrServerDraining
+	}
+
 	getMailbox := func() (*Mailbox, bool) {
 		s.mu.Lock()
 		defer s.mu.Unlock()
@@ -231,13 +312,22 @@ func (s *Server) Process(c netcontext.Context, d *Delivery) (*Delivery, error) {
 		return nil, ErrUnknownMailbox
 	}
 
-	// Decode the request into an actual msg.
-	msg, err := codec.Unmarshal(d.Data, d.TypeName)
+	// Decompress and decode the request into an actual msg.
+	data, err := decompress(d.Data, d.Compression, s.cfg.MaxMessageSize)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := codec.UnmarshalCodec(data, d.TypeName, d.CodecName)
 	if err != nil {
 		return nil, err
 	}
 
+	if d.FencingToken != 0 {
+		c = withReceivedFencingToken(c, d.FencingToken)
+	}
 	req := newRequest(c, msg)
+	req.compressionThreshold = s.cfg.CompressionThreshold
+	req.acceptCompression = d.AcceptCompression
 
 	// Send the filled envelope to the actual
 	// receiver. Also note that the receiver
@@ -271,7 +361,12 @@ func (s *Server) runMailbox(mailbox *Mailbox) {
 		case req := <-mailbox.C:
 			switch msg := req.Msg().(type) {
 			case *ActorStart:
-				err := s.startActorC(req.Context(), msg)
+				var err error
+				if s.isDraining() {
+					err = ErrServerDraining
+				} else {
+					err = s.startActorC(req.Context(), msg)
+				}
 				if err != nil {
 					err2 := req.Respond(err)
 					if err2 != nil {
@@ -305,69 +400,57 @@ func (s *Server) monitorFatalErrors() {
 	}()
 }
 
-// monitorRegistry for errors in the background.
-func (s *Server) monitorRegistry(addr net.Addr) error {
-	regFaults, err := s.registry.Start(addr)
-	if err != nil {
-		return err
-	}
+// monitorSchemas of the registered message types, and update the
+// peer's registration when types are registered after the server
+// has started. Failed updates are tried again after the timeout.
+func (s *Server) monitorSchemas(nsName string, changed <-chan struct{}) {
 	go func() {
-		select {
-		case <-s.ctx.Done():
-			return
-		case err := <-regFaults:
-			s.reportFatalError(err)
-		}
-	}()
-	return nil
-}
-
-// monitorLeader starts a leader and keeps tyring to start
-// a leader thereafter. If the leader should die on any
-// host then some peer will eventually have it start again.
-func (s *Server) monitorLeader() {
-	startLeader := func() error {
-		var err error
-		for i := 0; i < 6; i++ {
+		var retry <-chan time.Time
+		for {
 			select {
 			case <-s.ctx.Done():
-				return nil
-			default:
+				return
+			case <-changed:
+			case <-retry:
 			}
-			time.Sleep(1 * time.Second)
-			err = s.startActor(s.cfg.Timeout, &ActorStart{Name: "leader", Type: "leader"})
-			if err != nil && strings.Contains(err.Error(), registry.ErrAlreadyRegistered.Error()) {
-				return nil
+			changed = codec.Changed()
+			retry = nil
+			timeout, cancel := context.WithTimeout(s.ctx, s.cfg.Timeout)
+			err := s.registry.Update(timeout, nsName, registry.Update{Schemas: codec.Schemas()})
+			cancel()
+			if err != nil {
+				s.logf("%v: failed to publish schemas: %v", s.cfg.Namespace, err)
+				retry = time.After(s.cfg.Timeout)
 			}
 		}
+	}()
+}
+
+// monitorRegistry for errors in the background.
+func (s *Server) monitorRegistry(addr net.Addr) error {
+	regFaults, err := s.registry.Start(addr)
+	if err != nil {
 		return err
 	}
-
 	go func() {
-		timer := time.NewTimer(0 * time.Second)
-		defer timer.Stop()
 		for {
 			select {
 			case <-s.ctx.Done():
 				return
-			case <-timer.C:
-				err := startLeader()
-				if err == ErrDefNotRegistered {
-					s.logf("skipping leader startup since leader definition not registered")
-					return
-				}
-				if err == ErrNilActor {
-					s.logf("skipping leader startup since make leader returned nil")
+			case err := <-regFaults:
+				if !s.cfg.RecoverLease {
+					s.reportFatalError(err)
 					return
 				}
+				regFaults, err = s.recoverLease(err)
 				if err != nil {
-					s.reportFatalError(fmt.Errorf("leader start failed: %v", err))
-				} else {
-					timer.Reset(30 * time.Second)
+					s.reportFatalError(err)
+					return
 				}
 			}
 		}
 	}()
+	return nil
 }
 
 // reportFatalError to the fatal error monitor. The
@@ -438,7 +521,7 @@ func (s *Server) startActorC(c context.Context, start *ActorStart) error {
 	// prevent an actor from starting twice on one system or
 	// many systems.
 	timeout, cancel := context.WithTimeout(c, s.cfg.Timeout)
-	err = s.registry.Register(timeout, nsName)
+	err = s.registry.Register(timeout, nsName, start.Annotations...)
 	cancel()
 	if err != nil {
 		return err
@@ -446,15 +529,24 @@ func (s *Server) startActorC(c context.Context, start *ActorStart) error {
 
 	// The actor's context contains its full id, it's name and the
 	// full registration, which contains the actor's namespace.
-	actorCtx := context.WithValue(s.ctx, contextKey, &contextVal{
+	actorCtx, actorCancel := context.WithCancel(s.ctx)
+	actorCtx = context.WithValue(actorCtx, contextKey, &contextVal{
 		server:    s,
 		actorID:   nsName,
 		actorName: start.Name,
 	})
 
+	s.running[start.Name] = &runningActor{actor: actor, cancel: actorCancel}
+
 	// Start the actor, unregister the actor in case of failure
 	// and capture panics that the actor raises.
 	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, start.Name)
+			s.mu.Unlock()
+			actorCancel()
+		}()
 		defer func() {
 			timeout, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
 			s.registry.Deregister(timeout, nsName)
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/lytics/grid/codec"
 	"github.com/lytics/grid/testetcd"
 )
 
@@ -209,3 +210,52 @@ func TestServerStartThenEtcdStop(t *testing.T) {
 		}
 	}
 }
+
+// BenchmarkServerProcess checks how fast, and with how many
+// allocations, a request is decoded, delivered to a mailbox,
+// and its response encoded.
+func BenchmarkServerProcess(b *testing.B) {
+	namespace := newNamespace()
+	nsName, err := namespaceName(Mailboxes, namespace, "echo")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// Server with a single mailbox, which needs
+	// neither etcd nor a listener to process.
+	c := make(chan Request, 1)
+	s := &Server{
+		cfg:       ServerCfg{Namespace: namespace},
+		mailboxes: map[string]*Mailbox{nsName: {name: "echo", nsName: nsName, C: c, c: c}},
+	}
+	go func() {
+		for req := range c {
+			req.Respond(req.Msg())
+		}
+	}()
+	defer close(c)
+
+	typeName, codecName, data, err := codec.MarshalCodec(&EchoMsg{Msg: "testing 1, 2, 3"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	d := &Delivery{
+		Ver:       Delivery_V1,
+		Data:      data,
+		TypeName:  typeName,
+		Receiver:  nsName,
+		CodecName: codecName,
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res, err := s.Process(context.Background(), d)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if res.TypeName != typeName {
+			b.Fatal("wrong response type")
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package grid
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lytics/grid/registry"
+)
+
+// singleton registered with the server.
+type singleton struct {
+	actorType string
+	cfg       SingletonCfg
+}
+
+// RegisterSingleton marks the actor type as a cluster singleton.
+// When Serve is called, each peer with the singleton registered
+// competes to start it, under the name in the config, and starts
+// it again if it dies anywhere. The actor type's definition must
+// also be registered with RegisterDef, and singletons must be
+// registered before Serve is called, for example:
+//
+//     server.RegisterDef("scheduler", makeScheduler)
+//     err := server.RegisterSingleton("scheduler", grid.SingletonCfg{
+//         FailoverDelay: 2 * time.Second,
+//         Prefer:        []string{"tier=control"},
+//     })
+//
+// An actor type registered with RegisterDef as "leader" is a
+// singleton even if not registered with RegisterSingleton,
+// unless ServerCfg.DisalowLeadership is set. Placement is only
+// considered when starting a singleton, a running singleton is
+// not moved to a more preferred peer.
+func (s *Server) RegisterSingleton(actorType string, cfg SingletonCfg) error {
+	setSingletonCfgDefaults(actorType, &cfg)
+
+	if !isNameValid(actorType) {
+		return ErrInvalidActorType
+	}
+	if !isNameValid(cfg.Name) {
+		return ErrInvalidActorName
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.singletons[cfg.Name]; ok {
+		return ErrDuplicateSingleton
+	}
+	s.singletons[cfg.Name] = &singleton{actorType: actorType, cfg: cfg}
+	return nil
+}
+
+// monitorSingletons starts a monitor of each singleton this peer
+// may run, including the leader.
+func (s *Server) monitorSingletons() {
+	s.mu.Lock()
+	singletons := make([]*singleton, 0, len(s.singletons)+1)
+	for _, sg := range s.singletons {
+		singletons = append(singletons, sg)
+	}
+	_, hasLeader := s.singletons[leaderName]
+	s.mu.Unlock()
+
+	if !hasLeader {
+		leader := &singleton{actorType: leaderName}
+		setSingletonCfgDefaults(leaderName, &leader.cfg)
+		singletons = append(singletons, leader)
+	}
+
+	for _, sg := range singletons {
+		if sg.cfg.Name == leaderName && s.cfg.DisalowLeadership {
+			s.logf("skipping leader startup since leadership is disallowed on this peer")
+			continue
+		}
+		if !hasAnnotations(s.cfg.Annotations, sg.cfg.Require) {
+			s.logf("skipping singleton: %v startup since peer lacks required annotations: %v", sg.cfg.Name, sg.cfg.Require)
+			continue
+		}
+		go s.monitorSingleton(sg)
+	}
+}
+
+// monitorSingleton starts the singleton and keeps trying to start
+// it thereafter, whenever it is seen to be lost, and at the check
+// interval. If the singleton should die on any host then some peer
+// will eventually have it start again.
+func (s *Server) monitorSingleton(sg *singleton) {
+	cfg := sg.cfg
+	start := &ActorStart{
+		Type:        sg.actorType,
+		Name:        cfg.Name,
+		Data:        cfg.Data,
+		Annotations: cfg.Annotations,
+	}
+	delay := placementDelay(cfg, s.cfg.Annotations)
+
+	startSingleton := func() error {
+		var err error
+		backoff := cfg.Backoff
+		wait := delay
+		for i := 0; i < cfg.Attempts; i++ {
+			select {
+			case <-s.ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+			// Draining peers leave the singleton
+			// to be started by another peer.
+			if s.isDraining() {
+				return nil
+			}
+			err = s.startActor(s.cfg.Timeout, start)
+			if err == nil || strings.Contains(err.Error(), registry.ErrAlreadyRegistered.Error()) {
+				return nil
+			}
+			wait = backoff
+			backoff *= 2
+			if backoff > cfg.MaxBackoff {
+				backoff = cfg.MaxBackoff
+			}
+		}
+		return err
+	}
+
+	nsName, err := namespaceName(Actors, s.cfg.Namespace, cfg.Name)
+	if err != nil {
+		s.reportFatalError(fmt.Errorf("singleton: %v start failed: %v", cfg.Name, err))
+		return
+	}
+
+	// Watch the singleton's registration so that its loss is
+	// seen without waiting for the check interval. If the watch
+	// fails the check interval is all that remains.
+	var lost <-chan *registry.WatchEvent
+	_, changes, err := s.registry.ResumeWatch(s.ctx, nsName)
+	if err != nil {
+		s.logf("singleton: %v, failed to watch registration: %v", cfg.Name, err)
+	} else {
+		lost = changes
+	}
+
+	timer := time.NewTimer(0 * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case change, open := <-lost:
+			if !open || change.Error != nil {
+				s.logf("singleton: %v, watch of registration closed", cfg.Name)
+				lost = nil
+				continue
+			}
+			// The watch is of a prefix, so registrations of
+			// other actors whose names start with the name
+			// of the singleton must be ignored.
+			if change.Key != nsName || change.Type != registry.Delete {
+				continue
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
+		}
+
+		err := startSingleton()
+		if err == ErrDefNotRegistered {
+			s.logf("skipping singleton: %v startup since definition not registered", cfg.Name)
+			return
+		}
+		if err == ErrNilActor {
+			s.logf("skipping singleton: %v startup since make actor returned nil", cfg.Name)
+			return
+		}
+		if err != nil {
+			s.reportFatalError(fmt.Errorf("singleton: %v start failed: %v", cfg.Name, err))
+		} else {
+			timer.Reset(cfg.CheckInterval)
+		}
+	}
+}
+
+// placementDelay of a peer with the given annotations, before
+// it tries to start the singleton, which is the failover delay
+// plus one more for each preferred annotation the peer lacks.
+func placementDelay(cfg SingletonCfg, annotations []string) time.Duration {
+	missing := 0
+	for _, p := range cfg.Prefer {
+		if !hasAnnotation(annotations, p) {
+			missing++
+		}
+	}
+	return time.Duration(1+missing) * cfg.FailoverDelay
+}
+
+func hasAnnotations(annotations, required []string) bool {
+	for _, r := range required {
+		if !hasAnnotation(annotations, r) {
+			return false
+		}
+	}
+	return true
+}
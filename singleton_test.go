@@ -0,0 +1,97 @@
+package grid
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPlacementDelay(t *testing.T) {
+	cfg := SingletonCfg{Prefer: []string{"tier=control", "zone=a"}}
+	setSingletonCfgDefaults("scheduler", &cfg)
+
+	if d := placementDelay(cfg, []string{"zone=a", "tier=control"}); d != 1*time.Second {
+		t.Fatalf("expected 1s delay for preferred peer, found: %v", d)
+	}
+	if d := placementDelay(cfg, []string{"zone=a"}); d != 2*time.Second {
+		t.Fatalf("expected 2s delay for partly preferred peer, found: %v", d)
+	}
+	if d := placementDelay(cfg, nil); d != 3*time.Second {
+		t.Fatalf("expected 3s delay for other peer, found: %v", d)
+	}
+}
+
+func TestRegisterSingleton(t *testing.T) {
+	server := &Server{singletons: map[string]*singleton{}}
+
+	if err := server.RegisterSingleton("scheduler", SingletonCfg{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterSingleton("scheduler", SingletonCfg{}); err != ErrDuplicateSingleton {
+		t.Fatalf("expected error: %v, found: %v", ErrDuplicateSingleton, err)
+	}
+	if err := server.RegisterSingleton("scheduler", SingletonCfg{Name: "scheduler-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterSingleton("scheduler", SingletonCfg{Name: "invalid-!"}); err != ErrInvalidActorName {
+		t.Fatalf("expected error: %v, found: %v", ErrInvalidActorName, err)
+	}
+}
+
+func TestSingletonFailover(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	servers := make([]*Server, 2)
+	for i := range servers {
+		s, err := NewServer(etcd, ServerCfg{Namespace: server.cfg.Namespace})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.RegisterDef("scheduler", func(_ []byte) (Actor, error) { return &leaderActor{}, nil })
+		err = s.RegisterSingleton("scheduler", SingletonCfg{FailoverDelay: 200 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lis, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go s.Serve(lis)
+		defer s.Stop()
+		servers[i] = s
+	}
+
+	// Peer running the singleton, once exactly one
+	// does, and it is not the excluded peer.
+	running := func(exclude string) string {
+		t0 := time.Now()
+		for time.Since(t0) < 20*time.Second {
+			actors, err := client.QueryBy(timeout, NewQuery(Actors).NameGlob("scheduler"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(actors) == 1 && actors[0].Peer() != exclude {
+				return actors[0].Peer()
+			}
+			if len(actors) > 1 {
+				t.Fatalf("expected one singleton, found: %v", len(actors))
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatal("timeout")
+		return ""
+	}
+
+	first := running("")
+	for _, s := range servers {
+		if s.registry.Registry() == first {
+			s.Stop()
+		}
+	}
+	running(first)
+}
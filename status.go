@@ -0,0 +1,104 @@
+package grid
+
+import (
+	"context"
+
+	"github.com/lytics/grid/registry"
+)
+
+const (
+	// StatusReady of an entity which has not reported any other
+	// status, which is every entity until it is updated.
+	StatusReady = "ready"
+	// StatusDraining of a peer which is draining, see Server.Drain.
+	StatusDraining = "draining"
+	// StatusDegraded of an entity which is running, but should be
+	// avoided, for example because a dependency is unavailable.
+	StatusDegraded = "degraded"
+)
+
+// Update of the registration of a peer, actor, or mailbox, made in
+// place, so the entity is not lost and found again. Watchers of the
+// entity see an EntityUpdated event.
+type Update struct {
+	// Status replacing the entity's, unless empty. Any status can
+	// be used, though StatusReady, StatusDraining, and StatusDegraded
+	// are the ones the grid library itself understands.
+	Status string
+	// Annotations replacing the entity's, unless nil.
+	Annotations []string
+}
+
+// UpdatePeer updates the registration of this server's peer.
+//
+// Example usage:
+//
+//     err := server.UpdatePeer(ctx, grid.Update{Status: grid.StatusDegraded})
+//
+func (s *Server) UpdatePeer(c context.Context, u Update) error {
+	if s.registry == nil {
+		return ErrServerNotRunning
+	}
+	nsName, err := namespaceName(Peers, s.cfg.Namespace, s.registry.Registry())
+	if err != nil {
+		return err
+	}
+	return s.update(c, nsName, u)
+}
+
+// UpdateActor updates the registration of the actor running with the
+// given context, which must be the context passed to the actor's Act.
+func UpdateActor(c context.Context, u Update) error {
+	v := c.Value(contextKey)
+	if v == nil {
+		return ErrInvalidContext
+	}
+	cv, ok := v.(*contextVal)
+	if !ok || cv.actorID == "" {
+		return ErrInvalidContext
+	}
+	return cv.server.update(c, cv.actorID, u)
+}
+
+// Update the mailbox's registration. Only the server which created
+// the mailbox can update it.
+func (box *Mailbox) Update(c context.Context, u Update) error {
+	box.mu.Lock()
+	defer box.mu.Unlock()
+
+	if box.closed {
+		return ErrOwnershipLost
+	}
+	err := box.update(c, u)
+	if err != nil {
+		return err
+	}
+	if u.Annotations != nil {
+		box.annotations = u.Annotations
+	}
+	return nil
+}
+
+// update the registration under the namespaced name.
+func (s *Server) update(c context.Context, nsName string, u Update) error {
+	err := s.registry.Update(c, nsName, registry.Update{
+		Annotations: u.Annotations,
+		Status:      u.Status,
+	})
+	switch err {
+	case registry.ErrNotOwner, registry.ErrUnknownKey:
+		return ErrOwnershipLost
+	case registry.ErrNotStarted:
+		return ErrServerNotRunning
+	}
+	return err
+}
+
+// Status of the entity, StatusReady unless its registration has
+// been updated with another status, see Update.
+func (e *QueryEvent) Status() string {
+	if e.status == "" {
+		return StatusReady
+	}
+	return e.status
+}
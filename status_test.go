@@ -0,0 +1,103 @@
+package grid
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUpdateMailbox(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	mailbox, err := NewMailbox(server, "updated", 1, "role=ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mailbox.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	current, watch, err := client.QueryWatchBy(ctx, NewQuery(Mailboxes).NamePrefix("updated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 1 || current[0].Status() != StatusReady {
+		t.Fatalf("expected 1 ready mailbox, found: %v", current)
+	}
+
+	err = mailbox.Update(ctx, Update{Status: StatusDegraded, Annotations: []string{"role=egress"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-watch:
+		if e.Type != EntityUpdated || e.Name() != "updated" || e.Status() != StatusDegraded {
+			t.Fatalf("expected mailbox updated to degraded, got: %v", e)
+		}
+		if len(e.Annotations()) != 1 || e.Annotations()[0] != "role=egress" {
+			t.Fatalf("expected updated annotations, got: %v", e.Annotations())
+		}
+	case <-ctx.Done():
+		t.Fatal("expected watch event")
+	}
+	if len(mailbox.Annotations()) != 1 || mailbox.Annotations()[0] != "role=egress" {
+		t.Fatalf("expected mailbox annotations updated, got: %v", mailbox.Annotations())
+	}
+
+	res, err := client.QueryByC(ctx, NewQuery(Mailboxes).Status(StatusDegraded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Name() != "updated" {
+		t.Fatalf("expected only the degraded mailbox, got: %v", res)
+	}
+
+	mailbox.Close()
+	err = mailbox.Update(ctx, Update{Status: StatusReady})
+	if err != ErrOwnershipLost {
+		t.Fatalf("expected error: %v, got: %v", ErrOwnershipLost, err)
+	}
+}
+
+func TestUpdatePeer(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	etcd, server, client := bootstrapClientTest(t)
+	defer etcd.Close()
+	defer server.Stop()
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, watch, err := client.QueryWatch(ctx, Peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = server.UpdatePeer(ctx, Update{Status: StatusDegraded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-watch:
+		if e.Type != EntityUpdated || e.Status() != StatusDegraded || e.Draining() {
+			t.Fatalf("expected peer updated to degraded, got: %v", e)
+		}
+	case <-ctx.Done():
+		t.Fatal("expected watch event")
+	}
+}
+
+func TestUpdateActorInvalidContext(t *testing.T) {
+	err := UpdateActor(context.Background(), Update{Status: StatusDegraded})
+	if err != ErrInvalidContext {
+		t.Fatalf("expected error: %v, got: %v", ErrInvalidContext, err)
+	}
+}
@@ -54,11 +54,36 @@ func (x Delivery_Ver) String() string {
 }
 func (Delivery_Ver) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 0} }
 
+type Delivery_Compression int32
+
+const (
+	Delivery_None Delivery_Compression = 0
+	Delivery_Gzip Delivery_Compression = 1
+)
+
+var Delivery_Compression_name = map[int32]string{
+	0: "None",
+	1: "Gzip",
+}
+var Delivery_Compression_value = map[string]int32{
+	"None": 0,
+	"Gzip": 1,
+}
+
+func (x Delivery_Compression) String() string {
+	return proto.EnumName(Delivery_Compression_name, int32(x))
+}
+func (Delivery_Compression) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 1} }
+
 type Delivery struct {
-	Ver      Delivery_Ver `protobuf:"varint,1,opt,name=ver,enum=grid.Delivery_Ver" json:"ver,omitempty"`
-	Data     []byte       `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
-	TypeName string       `protobuf:"bytes,3,opt,name=typeName" json:"typeName,omitempty"`
-	Receiver string       `protobuf:"bytes,4,opt,name=receiver" json:"receiver,omitempty"`
+	Ver               Delivery_Ver           `protobuf:"varint,1,opt,name=ver,enum=grid.Delivery_Ver" json:"ver,omitempty"`
+	Data              []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	TypeName          string                 `protobuf:"bytes,3,opt,name=typeName" json:"typeName,omitempty"`
+	Receiver          string                 `protobuf:"bytes,4,opt,name=receiver" json:"receiver,omitempty"`
+	CodecName         string                 `protobuf:"bytes,5,opt,name=codecName" json:"codecName,omitempty"`
+	Compression       Delivery_Compression   `protobuf:"varint,6,opt,name=compression,enum=grid.Delivery_Compression" json:"compression,omitempty"`
+	AcceptCompression []Delivery_Compression `protobuf:"varint,7,rep,packed,name=acceptCompression,enum=grid.Delivery_Compression" json:"acceptCompression,omitempty"`
+	FencingToken      int64                  `protobuf:"varint,8,opt,name=fencingToken" json:"fencingToken,omitempty"`
 }
 
 func (m *Delivery) Reset()                    { *m = Delivery{} }
@@ -94,10 +119,39 @@ func (m *Delivery) GetReceiver() string {
 	return ""
 }
 
+func (m *Delivery) GetCodecName() string {
+	if m != nil {
+		return m.CodecName
+	}
+	return ""
+}
+
+func (m *Delivery) GetCompression() Delivery_Compression {
+	if m != nil {
+		return m.Compression
+	}
+	return Delivery_None
+}
+
+func (m *Delivery) GetAcceptCompression() []Delivery_Compression {
+	if m != nil {
+		return m.AcceptCompression
+	}
+	return nil
+}
+
+func (m *Delivery) GetFencingToken() int64 {
+	if m != nil {
+		return m.FencingToken
+	}
+	return 0
+}
+
 type ActorStart struct {
-	Type string `protobuf:"bytes,1,opt,name=type" json:"type,omitempty"`
-	Name string `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
-	Data []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Type        string   `protobuf:"bytes,1,opt,name=type" json:"type,omitempty"`
+	Name        string   `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
+	Data        []byte   `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Annotations []string `protobuf:"bytes,4,rep,name=annotations" json:"annotations,omitempty"`
 }
 
 func (m *ActorStart) Reset()                    { *m = ActorStart{} }
@@ -126,6 +180,13 @@ func (m *ActorStart) GetData() []byte {
 	return nil
 }
 
+func (m *ActorStart) GetAnnotations() []string {
+	if m != nil {
+		return m.Annotations
+	}
+	return nil
+}
+
 type Ack struct {
 }
 
@@ -156,6 +217,7 @@ func init() {
 	proto.RegisterType((*Ack)(nil), "grid.Ack")
 	proto.RegisterType((*EchoMsg)(nil), "grid.EchoMsg")
 	proto.RegisterEnum("grid.Delivery_Ver", Delivery_Ver_name, Delivery_Ver_value)
+	proto.RegisterEnum("grid.Delivery_Compression", Delivery_Compression_name, Delivery_Compression_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -233,21 +295,27 @@ var _Wire_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("wire.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 243 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x5c, 0x90, 0x4f, 0x4b, 0x03, 0x31,
-	0x10, 0xc5, 0x9b, 0xcd, 0xda, 0x3f, 0x83, 0x96, 0x32, 0xa7, 0xa5, 0x5e, 0x96, 0xe0, 0x61, 0x41,
-	0x58, 0xb0, 0xfd, 0x04, 0x05, 0x05, 0x2f, 0x8a, 0xac, 0xb0, 0xf7, 0x98, 0x0e, 0xeb, 0xa2, 0x35,
-	0x65, 0x12, 0x2a, 0xfd, 0x0c, 0x7e, 0x69, 0x99, 0xd4, 0x56, 0xf4, 0xf6, 0xde, 0xfc, 0xc2, 0x9b,
-	0x97, 0x01, 0xf8, 0xec, 0x99, 0xea, 0x2d, 0xfb, 0xe8, 0x31, 0xef, 0xb8, 0x5f, 0x9b, 0x2f, 0x05,
-	0xe3, 0x5b, 0x7a, 0xef, 0x77, 0xc4, 0x7b, 0xbc, 0x02, 0xbd, 0x23, 0x2e, 0x54, 0xa9, 0xaa, 0xe9,
-	0x02, 0x6b, 0x79, 0x50, 0x1f, 0x61, 0xdd, 0x12, 0x37, 0x82, 0x11, 0x21, 0x5f, 0xdb, 0x68, 0x8b,
-	0xac, 0x54, 0xd5, 0x79, 0x93, 0x34, 0xce, 0x61, 0x1c, 0xf7, 0x5b, 0x7a, 0xb4, 0x1b, 0x2a, 0x74,
-	0xa9, 0xaa, 0x49, 0x73, 0xf2, 0xc2, 0x98, 0x1c, 0x49, 0x4a, 0x91, 0x1f, 0xd8, 0xd1, 0x9b, 0x0b,
-	0xd0, 0x2d, 0x31, 0x0e, 0x21, 0x6b, 0x6f, 0x66, 0x03, 0x73, 0x0f, 0xb0, 0x72, 0xd1, 0xf3, 0x73,
-	0xb4, 0x1c, 0x65, 0x91, 0x84, 0xa4, 0x3e, 0x93, 0x26, 0x69, 0x99, 0x7d, 0xc8, 0x92, 0xec, 0x30,
-	0x13, 0x7d, 0x2a, 0xa4, 0x7f, 0x0b, 0x99, 0x33, 0xd0, 0x2b, 0xf7, 0x66, 0x2e, 0x61, 0x74, 0xe7,
-	0x5e, 0xfd, 0x43, 0xe8, 0x70, 0x06, 0x7a, 0x13, 0xba, 0x9f, 0x30, 0x91, 0x8b, 0x25, 0xe4, 0x72,
-	0x0f, 0xbc, 0x86, 0xd1, 0x13, 0x7b, 0x47, 0x21, 0xe0, 0xf4, 0xef, 0xa7, 0xe7, 0xff, 0xbc, 0x19,
-	0xbc, 0x0c, 0xd3, 0xf5, 0x96, 0xdf, 0x01, 0x00, 0x00, 0xff, 0xff, 0x1c, 0x06, 0x11, 0x27, 0x4b,
-	0x01, 0x00, 0x00,
+	// 352 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x84, 0x92, 0xc1, 0x4f, 0xf2, 0x30,
+	0x18, 0xc6, 0xd9, 0x3a, 0x60, 0x7b, 0xe1, 0x23, 0xfb, 0x7a, 0x6a, 0xf8, 0xbe, 0xc3, 0x6c, 0x3c,
+	0x2c, 0x31, 0x59, 0x22, 0x5c, 0xbd, 0x10, 0x35, 0x7a, 0x91, 0x98, 0x69, 0xb8, 0xcf, 0xf2, 0x3a,
+	0x27, 0xd2, 0x2e, 0x5d, 0x83, 0xc1, 0xbf, 0xdc, 0xa3, 0xe9, 0x10, 0x18, 0x78, 0xf0, 0xf6, 0xbc,
+	0xcf, 0xf3, 0xf4, 0x6d, 0xf3, 0x4b, 0x01, 0xde, 0x0b, 0x8d, 0x49, 0xa9, 0x95, 0x51, 0xd4, 0xcb,
+	0x75, 0x31, 0xe7, 0x9f, 0x2e, 0xf8, 0x57, 0xf8, 0x56, 0xac, 0x50, 0xaf, 0xe9, 0x29, 0x90, 0x15,
+	0x6a, 0xe6, 0x44, 0x4e, 0x3c, 0x18, 0xd1, 0xc4, 0x16, 0x92, 0x6d, 0x98, 0xcc, 0x50, 0xa7, 0x36,
+	0xa6, 0x14, 0xbc, 0x79, 0x66, 0x32, 0xe6, 0x46, 0x4e, 0xdc, 0x4f, 0x6b, 0x4d, 0x87, 0xe0, 0x9b,
+	0x75, 0x89, 0xd3, 0x6c, 0x89, 0x8c, 0x44, 0x4e, 0x1c, 0xa4, 0xbb, 0xd9, 0x66, 0x1a, 0x05, 0xda,
+	0x2d, 0xcc, 0xdb, 0x64, 0xdb, 0x99, 0xfe, 0x87, 0x40, 0xa8, 0x39, 0x8a, 0xfa, 0x60, 0xbb, 0x0e,
+	0xf7, 0x06, 0xbd, 0x80, 0x9e, 0x50, 0xcb, 0x52, 0x63, 0x55, 0x15, 0x4a, 0xb2, 0x4e, 0xfd, 0xae,
+	0xe1, 0xd1, 0xbb, 0x2e, 0xf7, 0x8d, 0xb4, 0x59, 0xa7, 0xb7, 0xf0, 0x37, 0x13, 0x02, 0x4b, 0xd3,
+	0x68, 0xb0, 0x6e, 0x44, 0x7e, 0xd9, 0xf1, 0xf3, 0x10, 0xe5, 0xd0, 0x7f, 0x46, 0x29, 0x0a, 0x99,
+	0x3f, 0xaa, 0x05, 0x4a, 0xe6, 0x47, 0x4e, 0x4c, 0xd2, 0x03, 0x8f, 0xff, 0x01, 0x32, 0x43, 0x4d,
+	0x3b, 0xe0, 0xce, 0xce, 0xc3, 0x16, 0x3f, 0x81, 0x5e, 0x73, 0x83, 0x0f, 0xde, 0x54, 0x49, 0x0c,
+	0x5b, 0x56, 0xdd, 0x7c, 0x14, 0x65, 0xe8, 0xf0, 0x57, 0x80, 0x89, 0x30, 0x4a, 0x3f, 0x98, 0x4c,
+	0x1b, 0x4b, 0xd5, 0x12, 0xab, 0xe1, 0x07, 0x69, 0xad, 0xad, 0x27, 0x2d, 0x18, 0x77, 0xe3, 0x59,
+	0xbd, 0xa3, 0x4f, 0x1a, 0xf4, 0x23, 0xe8, 0x65, 0x52, 0x2a, 0x93, 0x99, 0x42, 0xc9, 0x8a, 0x79,
+	0x11, 0x89, 0x83, 0xb4, 0x69, 0xf1, 0x36, 0x90, 0x89, 0x58, 0xf0, 0x7f, 0xd0, 0xbd, 0x16, 0x2f,
+	0xea, 0xae, 0xca, 0x69, 0x08, 0x64, 0x59, 0xe5, 0xdf, 0xd7, 0x59, 0x39, 0x1a, 0x83, 0x67, 0xbf,
+	0x07, 0x3d, 0x83, 0xee, 0xbd, 0x56, 0x02, 0xab, 0x8a, 0x0e, 0x0e, 0x39, 0x0d, 0x8f, 0x66, 0xde,
+	0x7a, 0xea, 0xd4, 0x9f, 0x69, 0xfc, 0x35, 0x00, 0x3e, 0xf1, 0xd4, 0x6e, 0x5a, 0x02, 0x00, 0x00,
 }